@@ -2,7 +2,6 @@ package log
 
 import (
 	"io"
-	"os"
 	"syscall"
 	"unsafe"
 )
@@ -18,24 +17,56 @@ const (
 	colorRST = "\x1b[0;m"
 )
 
-func painter(c color, s string) string {
-	return string(c) + s + colorRST
+// WriterWrapper is implemented by writers wrapping another writer, e.g. a
+// buffered writer of os.Stdout, which lets IsTerminal see the wrapped one
+type WriterWrapper interface {
+	Unwrap() io.Writer
 }
 
+// maxUnwrap limits the unwrapping of writers in case of a cycle
+const maxUnwrap = 16
+
 // IsTerminal returns true if the given writer supports colored output
+//
+// Writers with a file descriptor i.e. syscall.Conn such as *os.File, or
+// interface{ Fd() uintptr }, are checked by their descriptor, WriterWrapper
+// are unwrapped until one of them is found. syscall.Conn is preferred as Fd
+// of *os.File puts the file into blocking mode.
 func IsTerminal(w io.Writer) bool {
-	var fd int
-	switch w {
-	case os.Stdout:
-		fd = syscall.Stdout
-	case os.Stderr:
-		fd = syscall.Stderr
-	case os.Stdin: // is this resonable?
-		fd = syscall.Stdin
-	default:
+	for i := 0; w != nil && i < maxUnwrap; i++ {
+		if c, ok := w.(syscall.Conn); ok {
+			return isTerminalConn(c)
+		}
+		if f, ok := w.(interface {
+			Fd() uintptr
+		}); ok {
+			return isTerminalFd(f.Fd())
+		}
+		ww, ok := w.(WriterWrapper)
+		if !ok {
+			return false
+		}
+		w = ww.Unwrap()
+	}
+	return false
+}
+
+func isTerminalConn(c syscall.Conn) bool {
+	rc, err := c.SyscallConn()
+	if err != nil {
 		return false
 	}
+	terminal := false
+	if err := rc.Control(func(fd uintptr) {
+		terminal = isTerminalFd(fd)
+	}); err != nil {
+		return false
+	}
+	return terminal
+}
+
+func isTerminalFd(fd uintptr) bool {
 	var termios syscall.Termios
-	_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(fd), ioctlReadTermios, uintptr(unsafe.Pointer(&termios)), 0, 0, 0)
+	_, _, err := syscall.Syscall6(syscall.SYS_IOCTL, fd, ioctlReadTermios, uintptr(unsafe.Pointer(&termios)), 0, 0, 0)
 	return err == 0
 }
@@ -0,0 +1,461 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/syslog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Config is the declarative configuration of handlers and loggers, which
+// can be decoded from JSON, YAML or TOML, e.g. in JSON:
+//
+//	{
+//	  "handlers": {
+//	    "console": {"type": "stdout", "format": "{{level}} {{name}} {{}}"},
+//	    "errors":  {"type": "file", "target": "/var/log/app.err", "level": "erro",
+//	                "rotate": "daily", "backups": 7, "compress": true},
+//	    "syslog":  {"type": "remote_syslog", "target": "tcp://127.0.0.1:514", "format": "json"}
+//	  },
+//	  "loggers": {
+//	    "root":   {"level": "info", "handlers": ["console", "errors"]},
+//	    "svc.db": {"level": "debug", "handlers": ["syslog"], "async": true}
+//	  }
+//	}
+type Config struct {
+	Handlers map[string]HandlerConfig `json:"handlers" yaml:"handlers" toml:"handlers"`
+	Loggers  map[string]LoggerConfig  `json:"loggers" yaml:"loggers" toml:"loggers"`
+}
+
+// HandlerConfig configures a handler
+//
+// Type is one of:
+//
+//	stdout, stderr  StreamHandler writing to os.Stdout or os.Stderr
+//	file            FileHandler writing to the file Target
+//	syslog          SyslogHandler using log/syslog, Target is empty for the
+//	                local syslog or "network://addr" for a remote one
+//	remote_syslog   RemoteSyslogHandler, Target is "network://addr"
+//
+// Format is the name of a registered Encoder e.g. "json" or "logfmt", or a
+// format string of Formatter with at least one placeholder, see
+// RegisterEncoder.
+type HandlerConfig struct {
+	Type   string `json:"type" yaml:"type" toml:"type"`
+	Target string `json:"target" yaml:"target" toml:"target"`
+	Format string `json:"format" yaml:"format" toml:"format"`
+	Level  string `json:"level" yaml:"level" toml:"level"`
+	// Color overrides whether the output of stdout and stderr is colored
+	Color *bool `json:"color" yaml:"color" toml:"color"`
+	// Multiline is "raw", "escape" or "indent", see MultilineOptions
+	Multiline       string `json:"multiline" yaml:"multiline" toml:"multiline"`
+	MultilineMarker string `json:"multiline_marker" yaml:"multiline_marker" toml:"multiline_marker"`
+
+	// file options, Rotate is "hourly" or "daily", see RotateOptions
+	MaxSize  int64  `json:"max_size" yaml:"max_size" toml:"max_size"`
+	Rotate   string `json:"rotate" yaml:"rotate" toml:"rotate"`
+	Backups  int    `json:"backups" yaml:"backups" toml:"backups"`
+	Compress bool   `json:"compress" yaml:"compress" toml:"compress"`
+
+	// syslog options, Tag is the tag of syslog and the AppName of
+	// remote_syslog, SyslogFormat is "rfc5424" or "rfc3164", Framing is
+	// "octet_counting" or "non_transparent"
+	Tag          string `json:"tag" yaml:"tag" toml:"tag"`
+	Facility     string `json:"facility" yaml:"facility" toml:"facility"`
+	SyslogFormat string `json:"syslog_format" yaml:"syslog_format" toml:"syslog_format"`
+	Framing      string `json:"framing" yaml:"framing" toml:"framing"`
+}
+
+// LoggerConfig configures a logger in the registry, "root" stands for the
+// root logger, see GetLogger
+type LoggerConfig struct {
+	Level    string   `json:"level" yaml:"level" toml:"level"`
+	Handlers []string `json:"handlers" yaml:"handlers" toml:"handlers"`
+	Async    bool     `json:"async" yaml:"async" toml:"async"`
+}
+
+// ConfigError aggregates all errors found in a Config
+type ConfigError []error
+
+func (e ConfigError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "log: invalid config: " + strings.Join(msgs, "; ")
+}
+
+var facilities = map[string]Facility{
+	"kern":     FacilityKern,
+	"user":     FacilityUser,
+	"mail":     FacilityMail,
+	"daemon":   FacilityDaemon,
+	"auth":     FacilityAuth,
+	"syslog":   FacilitySyslog,
+	"lpr":      FacilityLpr,
+	"news":     FacilityNews,
+	"uucp":     FacilityUucp,
+	"cron":     FacilityCron,
+	"authpriv": FacilityAuthpriv,
+	"ftp":      FacilityFtp,
+	"local0":   FacilityLocal0,
+	"local1":   FacilityLocal1,
+	"local2":   FacilityLocal2,
+	"local3":   FacilityLocal3,
+	"local4":   FacilityLocal4,
+	"local5":   FacilityLocal5,
+	"local6":   FacilityLocal6,
+	"local7":   FacilityLocal7,
+}
+
+// Configure reads a JSON Config from r and applies it, see ApplyConfig
+func Configure(r io.Reader) error {
+	return ConfigureWith(r, json.Unmarshal)
+}
+
+// ConfigureWith is like Configure but decodes the Config with unmarshal,
+// e.g. yaml.Unmarshal or toml.Unmarshal
+func ConfigureWith(r io.Reader, unmarshal func(data []byte, v interface{}) error) error {
+	c, err := readConfig(r, unmarshal)
+	if err != nil {
+		return err
+	}
+	return ApplyConfig(c)
+}
+
+func readConfig(r io.Reader, unmarshal func(data []byte, v interface{}) error) (*Config, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	c := new(Config)
+	if err := unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ApplyConfig builds all handlers of the Config and applies them along with
+// levels and async to the loggers in the registry, loggers not in the Config
+// are not changed
+//
+// Handlers replaced and no longer used by any logger are closed after their
+// async records are written, handlers not used by any logger in the Config
+// are checked but not kept open.
+//
+// Nothing is applied if the Config is invalid, a ConfigError is returned
+// with all problems found.
+func ApplyConfig(c *Config) error {
+	b, err := c.build()
+	if err != nil {
+		return err
+	}
+	return retire(b.apply())
+}
+
+type loggerPlan struct {
+	lv       LevelType
+	handlers []Handler
+	async    bool
+}
+
+type builtConfig struct {
+	handlers map[string]Handler
+	loggers  map[string]*loggerPlan
+}
+
+// build creates handlers and checks loggers of the Config, handlers are
+// closed if there is any error, or if no logger uses them
+func (c *Config) build() (*builtConfig, error) {
+	var errs ConfigError
+	b := &builtConfig{
+		handlers: make(map[string]Handler),
+		loggers:  make(map[string]*loggerPlan),
+	}
+
+	names := make([]string, 0, len(c.Handlers))
+	for name := range c.Handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h, err := buildHandler(c.Handlers[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("handler %q: %v", name, err))
+			continue
+		}
+		b.handlers[name] = h
+	}
+
+	names = make([]string, 0, len(c.Loggers))
+	for name := range c.Loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lc := c.Loggers[name]
+		plan := &loggerPlan{async: lc.Async}
+		if lc.Level != "" {
+			lv, err := ParseLevel(lc.Level)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("logger %q: %v", name, err))
+			}
+			plan.lv = lv
+		}
+		for _, hname := range lc.Handlers {
+			if h, ok := b.handlers[hname]; ok {
+				plan.handlers = append(plan.handlers, h)
+			} else if _, ok := c.Handlers[hname]; !ok {
+				errs = append(errs, fmt.Errorf("logger %q: unknown handler %q", name, hname))
+			}
+		}
+		if name == "root" {
+			name = ""
+		}
+		b.loggers[name] = plan
+	}
+
+	if len(errs) > 0 {
+		b.close()
+		return nil, errs
+	}
+
+	// handlers not referenced by any logger are only built to be checked
+	used := make(map[Handler]bool)
+	for _, plan := range b.loggers {
+		for _, h := range plan.handlers {
+			used[h] = true
+		}
+	}
+	for name, h := range b.handlers {
+		if !used[h] {
+			if c, ok := h.(io.Closer); ok {
+				c.Close()
+			}
+			delete(b.handlers, name)
+		}
+	}
+	return b, nil
+}
+
+// apply applies the built config to loggers, each logger is changed
+// atomically, handlers replaced and no longer used by any logger in the
+// registry are returned
+func (b *builtConfig) apply() []Handler {
+	replaced := make(map[Handler]bool)
+	for name, plan := range b.loggers {
+		l := GetLogger(name)
+		l.Lock()
+		for _, h := range l.setHandlers(plan.handlers) {
+			replaced[h] = true
+		}
+		l.lv = plan.lv
+		l.async = plan.async
+		l.Unlock()
+	}
+	for _, l := range Loggers() {
+		for _, h := range l.Handlers() {
+			delete(replaced, h)
+		}
+	}
+	hs := make([]Handler, 0, len(replaced))
+	for h := range replaced {
+		hs = append(hs, h)
+	}
+	return hs
+}
+
+// retire waits until async records of handlers are written, removes the
+// async workers of writers no longer used by any logger in the registry, and
+// closes handlers which implement io.Closer
+func retire(hs []Handler) error {
+	writers := make([]io.Writer, len(hs))
+	for i, h := range hs {
+		writers[i] = h.Writer()
+	}
+	err := wSupervisor.Flush(writers, FlushTimeout)
+
+	live := make(map[io.Writer]bool)
+	for _, l := range Loggers() {
+		for _, h := range l.Handlers() {
+			live[h.Writer()] = true
+		}
+	}
+	for _, h := range hs {
+		if w := h.Writer(); !live[w] {
+			wSupervisor.Remove(w)
+		}
+		if c, ok := h.(io.Closer); ok {
+			c.Close()
+		}
+	}
+	return err
+}
+
+// close closes all handlers which implement io.Closer
+func (b *builtConfig) close() {
+	for _, h := range b.handlers {
+		if c, ok := h.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// buildHandler creates the handler described by hc
+func buildHandler(hc HandlerConfig) (Handler, error) {
+	var lv LevelType
+	if hc.Level != "" {
+		var err error
+		if lv, err = ParseLevel(hc.Level); err != nil {
+			return nil, err
+		}
+	}
+	format := hc.Format
+	var enc Encoder
+	if format != "" {
+		enc, _ = NewEncoder(format)
+	}
+	if format == "" || enc != nil {
+		format = defaultTpl
+	} else if !strings.Contains(format, "{{") {
+		// most likely a misspelled encoder rather than a constant message
+		return nil, fmt.Errorf("unknown format: %q", hc.Format)
+	}
+
+	multiline := MultilineOptions{Marker: hc.MultilineMarker}
+	switch hc.Multiline {
+	case "", "raw":
+	case "escape":
+		multiline.Policy = MultilineEscape
+	case "indent":
+		multiline.Policy = MultilineIndent
+	default:
+		return nil, fmt.Errorf("unknown multiline: %q", hc.Multiline)
+	}
+
+	var h interface {
+		Handler
+		SetLevel(lv LevelType)
+		SetEncoder(e Encoder)
+		SetMultiline(opts MultilineOptions)
+	}
+	switch hc.Type {
+	case "stdout", "stderr":
+		w := os.Stdout
+		if hc.Type == "stderr" {
+			w = os.Stderr
+		}
+		sh, err := NewStreamHandler(w, format)
+		if err != nil {
+			return nil, err
+		}
+		if hc.Color != nil {
+			sh.Colored(*hc.Color)
+		}
+		h = sh
+	case "file":
+		opts := RotateOptions{
+			MaxSize:  hc.MaxSize,
+			Backups:  hc.Backups,
+			Compress: hc.Compress,
+		}
+		switch hc.Rotate {
+		case "":
+		case "hourly":
+			opts.Interval = RotateHourly
+		case "daily":
+			opts.Interval = RotateDaily
+		default:
+			return nil, fmt.Errorf("unknown rotate: %q", hc.Rotate)
+		}
+		if hc.Target == "" {
+			return nil, fmt.Errorf("target is required")
+		}
+		fh, err := NewFileHandler(hc.Target, format, opts)
+		if err != nil {
+			return nil, err
+		}
+		h = fh
+	case "syslog":
+		facility, err := parseFacility(hc.Facility)
+		if err != nil {
+			return nil, err
+		}
+		network, addr := splitTarget(hc.Target)
+		w, err := syslog.Dial(network, addr, syslog.Priority(facility<<3), hc.Tag)
+		if err != nil {
+			return nil, err
+		}
+		if hc.Format == "" {
+			format = syslogTpl
+		}
+		sh, err := NewSyslogHandlerWithFormat(w, format)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		h = sh
+	case "remote_syslog":
+		facility, err := parseFacility(hc.Facility)
+		if err != nil {
+			return nil, err
+		}
+		opts := RemoteSyslogOptions{Facility: facility, AppName: hc.Tag}
+		opts.Network, opts.Addr = splitTarget(hc.Target)
+		switch hc.SyslogFormat {
+		case "", "rfc5424":
+			opts.Format = RFC5424
+		case "rfc3164":
+			opts.Format = RFC3164
+		default:
+			return nil, fmt.Errorf("unknown syslog_format: %q", hc.SyslogFormat)
+		}
+		switch hc.Framing {
+		case "", "non_transparent":
+		case "octet_counting":
+			opts.Framing = OctetCountingFraming
+		default:
+			return nil, fmt.Errorf("unknown framing: %q", hc.Framing)
+		}
+		var rh *RemoteSyslogHandler
+		if hc.Format == "" || enc != nil {
+			rh, err = NewRemoteSyslogHandler(opts)
+		} else {
+			rh, err = NewRemoteSyslogHandlerWithFormat(opts, format)
+		}
+		if err != nil {
+			return nil, err
+		}
+		h = rh
+	default:
+		return nil, fmt.Errorf("unknown type: %q", hc.Type)
+	}
+	if enc != nil {
+		h.SetEncoder(enc)
+	}
+	h.SetMultiline(multiline)
+	h.SetLevel(lv)
+	return h, nil
+}
+
+func parseFacility(s string) (Facility, error) {
+	if s == "" {
+		return FacilityUser, nil
+	}
+	if f, ok := facilities[strings.ToLower(s)]; ok {
+		return f, nil
+	}
+	return 0, fmt.Errorf("unknown facility: %q", s)
+}
+
+// splitTarget splits "network://addr" into network and addr
+func splitTarget(target string) (network, addr string) {
+	if i := strings.Index(target, "://"); i >= 0 {
+		return target[:i], target[i+3:]
+	}
+	return "", target
+}
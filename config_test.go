@@ -0,0 +1,350 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigure(t *testing.T) {
+	ast := assert.New(t)
+	dir, err := ioutil.TempDir("", "log_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer unregister("cfg", "cfg.db")
+	text := filepath.Join(dir, "text.log")
+	js := filepath.Join(dir, "json.log")
+
+	err = Configure(strings.NewReader(`{
+		"handlers": {
+			"text": {"type": "file", "target": "` + text + `", "format": "{{level}} {{name}} {{}}", "level": "warn"},
+			"json": {"type": "file", "target": "` + js + `", "format": "json", "rotate": "daily"}
+		},
+		"loggers": {
+			"cfg":    {"level": "info", "handlers": ["text"]},
+			"cfg.db": {"level": "debug", "handlers": ["text", "json"], "async": true}
+		}
+	}`))
+	ast.NoError(err)
+
+	GetLogger("cfg").Info("ignored by handler")
+	GetLogger("cfg").Error("cfg error")
+	db := GetLogger("cfg.db")
+	db.Debug("db debug")
+	db.Warn("db warn")
+	ast.NoError(db.Close())
+
+	b, _ := ioutil.ReadFile(text)
+	ast.Equal("ERRO cfg cfg error\nWARN cfg.db db warn\n", string(b))
+	b, _ = ioutil.ReadFile(js)
+	ast.Equal(2, strings.Count(string(b), `"logger":"cfg.db"`))
+	ast.Equal(DEBUG, db.Level())
+}
+
+func TestConfigureErrors(t *testing.T) {
+	ast := assert.New(t)
+	defer unregister("bad")
+	err := Configure(strings.NewReader(`{
+		"handlers": {
+			"tpl":  {"type": "stdout", "format": "{{level"},
+			"kind": {"type": "kafka"},
+			"lv":   {"type": "stderr", "level": "loud"},
+			"ml":   {"type": "stdout", "multiline": "fold"},
+			"fmt":  {"type": "stdout", "format": "jsn"}
+		},
+		"loggers": {
+			"bad": {"level": "verbose", "handlers": ["tpl", "missing"]}
+		}
+	}`))
+	if !ast.Error(err) {
+		return
+	}
+	errs, ok := err.(ConfigError)
+	ast.True(ok)
+	ast.Len(errs, 7)
+	msg := err.Error()
+	ast.Contains(msg, `handler "fmt": unknown format: "jsn"`)
+	ast.Contains(msg, `handler "ml": unknown multiline: "fold"`)
+	ast.Contains(msg, `handler "kind": unknown type: "kafka"`)
+	ast.Contains(msg, `handler "lv": unknown log level: loud`)
+	ast.Contains(msg, `handler "tpl": template:`)
+	ast.Contains(msg, `logger "bad": unknown log level: verbose`)
+	ast.Contains(msg, `logger "bad": unknown handler "missing"`)
+
+	registry.Lock()
+	_, ok = registry.m["bad"]
+	registry.Unlock()
+	ast.False(ok)
+}
+
+func TestConfigUnusedHandler(t *testing.T) {
+	ast := assert.New(t)
+	dir, err := ioutil.TempDir("", "log_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &Config{
+		Handlers: map[string]HandlerConfig{
+			"used":   {Type: "file", Target: filepath.Join(dir, "used.log")},
+			"unused": {Type: "file", Target: filepath.Join(dir, "unused.log")},
+		},
+		Loggers: map[string]LoggerConfig{
+			"cfg.unused": {Handlers: []string{"used"}},
+		},
+	}
+	b, err := c.build()
+	if !ast.NoError(err) {
+		return
+	}
+	defer b.close()
+	ast.Contains(b.handlers, "used")
+	ast.NotContains(b.handlers, "unused")
+
+	c.Handlers["unused"] = HandlerConfig{Type: "file", Format: "{{ nope }}", Target: filepath.Join(dir, "unused.log")}
+	_, err = c.build()
+	ast.Error(err)
+}
+
+func TestConfigClosesSyslogOnError(t *testing.T) {
+	ast := assert.New(t)
+	dir, err := ioutil.TempDir("", "log_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "syslog.sock")
+	ln, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	c := &Config{
+		Handlers: map[string]HandlerConfig{
+			"sys": {Type: "syslog", Target: "unix://" + addr},
+			"bad": {Type: "stdout", Format: "jsn"},
+		},
+		Loggers: map[string]LoggerConfig{
+			"cfg.syslog": {Handlers: []string{"sys", "bad"}},
+		},
+	}
+	_, err = c.build()
+	ast.Error(err)
+
+	// the connection of the syslog handler is closed
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = ioutil.ReadAll(conn)
+	ast.NoError(err)
+}
+
+func TestWatchConfig(t *testing.T) {
+	ast := assert.New(t)
+	dir, err := ioutil.TempDir("", "log_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer unregister("watch")
+	path := filepath.Join(dir, "log.json")
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "second.log")
+	config := `{
+		"handlers": {"file": {"type": "file", "target": "%s", "format": "{{level}} {{}}"}},
+		"loggers": {"watch": {"level": "%s", "handlers": ["file"], "async": true}}
+	}`
+	write := func(target, level string) {
+		ast.NoError(ioutil.WriteFile(path, []byte(fmt.Sprintf(config, target, level)), 0644))
+	}
+
+	write(first, "info")
+	reloaded := make(chan error, 10)
+	w, err := WatchConfig(path, WatchOptions{
+		Interval: 10 * time.Millisecond,
+		OnReload: func(err error) { reloaded <- err },
+	})
+	if !ast.NoError(err) {
+		return
+	}
+	defer w.Close()
+
+	l := GetLogger("watch")
+	old := l.Handlers()[0].(*FileHandler)
+	l.Debug("dropped")
+	l.Info("first")
+
+	write(second, "debug")
+	select {
+	case err := <-reloaded:
+		ast.NoError(err)
+	case <-time.After(time.Second):
+		t.Fatal("config is not reloaded")
+	}
+	l.Debug("second")
+	ast.NoError(l.Flush())
+
+	b, _ := ioutil.ReadFile(first)
+	ast.Equal("INFO first\n", string(b))
+	b, _ = ioutil.ReadFile(second)
+	ast.Equal("DEBUG second\n", string(b))
+	_, err = old.Write([]byte("closed"))
+	ast.Equal(errFileHandlerClosed, err)
+
+	write(second, "loud")
+	ast.Error(w.Reload())
+	ast.Equal(DEBUG, l.Level())
+}
+
+func TestReloadWhileLogging(t *testing.T) {
+	ast := assert.New(t)
+	dir, err := ioutil.TempDir("", "log_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer unregister("reload", "reload.sync")
+	path := filepath.Join(dir, "log.json")
+	target := filepath.Join(dir, "reload.log")
+	ast.NoError(ioutil.WriteFile(path, []byte(`{
+		"handlers": {"file": {"type": "file", "target": "`+target+`", "format": "{{}}"}},
+		"loggers": {
+			"reload":      {"handlers": ["file"], "async": true},
+			"reload.sync": {"handlers": ["file"]}
+		}
+	}`), 0644))
+
+	w, err := WatchConfig(path, WatchOptions{Interval: -1})
+	if !ast.NoError(err) {
+		return
+	}
+	defer w.Close()
+	wSupervisor.mu.RLock()
+	workers := len(wSupervisor.m)
+	wSupervisor.mu.RUnlock()
+
+	const n = 500
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		loggers := []*Logger{
+			GetLogger("reload"),
+			GetLogger("reload.sync"),
+			GetLogger("reload.sync").With("k", "v"),
+		}
+		for _, l := range loggers {
+			wg.Add(1)
+			go func(l *Logger) {
+				defer wg.Done()
+				for i := 0; i < n; i++ {
+					l.Info("x")
+				}
+			}(l)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for reloading := true; reloading; {
+		select {
+		case <-done:
+			reloading = false
+		default:
+			ast.NoError(w.Reload())
+		}
+	}
+	ast.NoError(GetLogger("reload").Flush())
+
+	b, _ := ioutil.ReadFile(target)
+	ast.Equal(12*n, strings.Count(string(b), "\n"))
+	// at most the worker of the handler in use is left
+	wSupervisor.mu.RLock()
+	ast.True(len(wSupervisor.m) <= workers+1)
+	wSupervisor.mu.RUnlock()
+
+	w.Close()
+	w.Close()
+}
+
+// closingHandler blocks in Accept until released, and records whether Log
+// is called after Close
+type closingHandler struct {
+	accepting chan bool
+	release   chan bool
+	mu        sync.Mutex
+	closed    bool
+	lateLog   bool
+}
+
+func (h *closingHandler) Accept(r *Record) bool {
+	h.accepting <- true
+	<-h.release
+	return true
+}
+
+func (h *closingHandler) Log(r *Record) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lateLog = h.closed
+}
+
+func (h *closingHandler) Writer() io.Writer {
+	return ioutil.Discard
+}
+
+func (h *closingHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	return nil
+}
+
+func TestRetireWaitsForDispatch(t *testing.T) {
+	h := &closingHandler{accepting: make(chan bool), release: make(chan bool)}
+	l := NewWithWriter("test", nil)
+	l.AddHandler(h)
+
+	logged := make(chan bool)
+	go func() {
+		l.Info("in flight")
+		close(logged)
+	}()
+	<-h.accepting
+	retired := make(chan error)
+	go func() {
+		retired <- retire(l.SetHandlers(new(recordHandler)))
+	}()
+	// TryRLock fails once SetHandlers waits for the in-flight Record
+	for l.TryRLock() {
+		l.RUnlock()
+		runtime.Gosched()
+	}
+	select {
+	case <-retired:
+		t.Fatal("retire should wait for the in-flight Record")
+	default:
+	}
+	close(h.release)
+	<-logged
+	assert.NoError(t, <-retired)
+	assert.True(t, h.closed)
+	assert.False(t, h.lateLog)
+}
@@ -0,0 +1,127 @@
+package log
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultWatchInterval = time.Second
+
+// WatchOptions describes how a config file is watched
+type WatchOptions struct {
+	// Unmarshal decodes the file, json.Unmarshal if not set
+	Unmarshal func(data []byte, v interface{}) error
+	// Interval of checking whether the file is changed, 1s if not set,
+	// negative disables checking, the file is still reloaded on SIGHUP
+	Interval time.Duration
+	// OnReload is called after each reload with its error, nil if succeeded
+	OnReload func(err error)
+}
+
+// Watcher applies a config file on SIGHUP or when the file changes, see
+// ApplyConfig
+type Watcher struct {
+	path    string
+	opts    WatchOptions
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// WatchConfig applies the config file at path and watches it for changes,
+// the first error is returned without watching
+func WatchConfig(path string, opts WatchOptions) (*Watcher, error) {
+	if opts.Unmarshal == nil {
+		opts.Unmarshal = json.Unmarshal
+	}
+	if opts.Interval == 0 {
+		opts.Interval = defaultWatchInterval
+	}
+	w := &Watcher{
+		path: path,
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	go w.watch()
+	return w, nil
+}
+
+// Reload reads and applies the config file immediately
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f, err := os.Open(w.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	w.modTime, w.size = info.ModTime(), info.Size()
+	c, err := readConfig(f, w.opts.Unmarshal)
+	if err != nil {
+		return err
+	}
+	return ApplyConfig(c)
+}
+
+// Close stops watching, the applied config is kept, it's safe to call Close
+// more than once
+func (w *Watcher) Close() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+func (w *Watcher) watch() {
+	defer close(w.done)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if w.opts.Interval > 0 {
+		ticker := time.NewTicker(w.opts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-hup:
+		case <-tick:
+			if !w.changed() {
+				continue
+			}
+		}
+		err := w.Reload()
+		if w.opts.OnReload != nil {
+			w.opts.OnReload(err)
+		}
+	}
+}
+
+func (w *Watcher) changed() bool {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !info.ModTime().Equal(w.modTime) || info.Size() != w.size
+}
@@ -0,0 +1,109 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+type contextKey struct{}
+
+type contextValues struct {
+	rpcID     string
+	requestID string
+	fields    []Field
+}
+
+// NewContext returns a copy of ctx which carries the given RPC ID, request ID
+// and alternating keys and values
+//
+// Empty IDs keep the ones already carried by ctx, fields are merged with the
+// ones carried by ctx. Values carried by ctx are used by the *Ctx APIs of
+// Logger, they take precedence over those set on the logger.
+func NewContext(ctx context.Context, rpcID, requestID string, kv ...interface{}) context.Context {
+	v := &contextValues{rpcID: rpcID, requestID: requestID}
+	if parent, ok := ctx.Value(contextKey{}).(*contextValues); ok {
+		if v.rpcID == "" {
+			v.rpcID = parent.rpcID
+		}
+		if v.requestID == "" {
+			v.requestID = parent.requestID
+		}
+		v.fields = mergeFields(parent.fields, fieldsFromKV(kv))
+	} else {
+		v.fields = fieldsFromKV(kv)
+	}
+	return context.WithValue(ctx, contextKey{}, v)
+}
+
+// FromContext returns the RPC ID, request ID and fields carried by ctx, see
+// NewContext
+func FromContext(ctx context.Context) (rpcID, requestID string, fields []Field) {
+	v, ok := ctx.Value(contextKey{}).(*contextValues)
+	if !ok {
+		return "", "", nil
+	}
+	fields = make([]Field, len(v.fields))
+	copy(fields, v.fields)
+	return v.rpcID, v.requestID, fields
+}
+
+// DebugCtx calls Output to log with DEBUG level and values carried by ctx
+func (l *Logger) DebugCtx(ctx context.Context, a ...interface{}) {
+	l.output(2, DEBUG, "", fmt.Sprint(a...), ctx)
+}
+
+// DebugfCtx calls Output to log with DEBUG level, values carried by ctx and
+// given format
+func (l *Logger) DebugfCtx(ctx context.Context, f string, a ...interface{}) {
+	l.output(2, DEBUG, f, fmt.Sprintf(f, a...), ctx)
+}
+
+// InfoCtx calls Output to log with INFO level and values carried by ctx
+func (l *Logger) InfoCtx(ctx context.Context, a ...interface{}) {
+	l.output(2, INFO, "", fmt.Sprint(a...), ctx)
+}
+
+// InfofCtx calls Output to log with INFO level, values carried by ctx and
+// given format
+func (l *Logger) InfofCtx(ctx context.Context, f string, a ...interface{}) {
+	l.output(2, INFO, f, fmt.Sprintf(f, a...), ctx)
+}
+
+// WarnCtx calls Output to log with WARN level and values carried by ctx
+func (l *Logger) WarnCtx(ctx context.Context, a ...interface{}) {
+	l.output(2, WARN, "", fmt.Sprint(a...), ctx)
+}
+
+// WarnfCtx calls Output to log with WARN level, values carried by ctx and
+// given format
+func (l *Logger) WarnfCtx(ctx context.Context, f string, a ...interface{}) {
+	l.output(2, WARN, f, fmt.Sprintf(f, a...), ctx)
+}
+
+// ErrorCtx calls Output to log with ERRO level and values carried by ctx
+func (l *Logger) ErrorCtx(ctx context.Context, a ...interface{}) {
+	l.output(2, ERRO, "", fmt.Sprint(a...), ctx)
+}
+
+// ErrorfCtx calls Output to log with ERRO level, values carried by ctx and
+// given format
+func (l *Logger) ErrorfCtx(ctx context.Context, f string, a ...interface{}) {
+	l.output(2, ERRO, f, fmt.Sprintf(f, a...), ctx)
+}
+
+// FatalCtx calls Output to log with FATA level and values carried by ctx,
+// followed by a call to os.Exit(1)
+func (l *Logger) FatalCtx(ctx context.Context, a ...interface{}) {
+	l.output(2, FATA, "", fmt.Sprint(a...), ctx)
+	l.Flush()
+	os.Exit(1)
+}
+
+// FatalfCtx calls Output to log with FATA level, values carried by ctx and
+// given format, followed by a call to os.Exit(1)
+func (l *Logger) FatalfCtx(ctx context.Context, f string, a ...interface{}) {
+	l.output(2, FATA, f, fmt.Sprintf(f, a...), ctx)
+	l.Flush()
+	os.Exit(1)
+}
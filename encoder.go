@@ -0,0 +1,166 @@
+package log
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Encoder encodes a Record into bytes, Formatter and JSONFormatter are the
+// builtin implementations
+type Encoder interface {
+	// AppendFormat appends the encoded Record to dst and returns the
+	// extended buffer
+	AppendFormat(dst []byte, r *Record) []byte
+}
+
+// SingleLineEncoder is implemented by Encoders which escape newlines by
+// themselves, MultilineOptions of handlers are not applied to the output of
+// an Encoder whose SingleLine returns true
+type SingleLineEncoder interface {
+	Encoder
+	SingleLine() bool
+}
+
+// EncoderFunc is an adapter to use an ordinary function as Encoder
+type EncoderFunc func(dst []byte, r *Record) []byte
+
+// AppendFormat calls f(dst, r)
+func (f EncoderFunc) AppendFormat(dst []byte, r *Record) []byte {
+	return f(dst, r)
+}
+
+var encoders = struct {
+	sync.RWMutex
+	m map[string]func() Encoder
+}{
+	m: map[string]func() Encoder{
+		"json":   func() Encoder { return NewJSONFormatter() },
+		"logfmt": func() Encoder { return NewLogfmtFormatter() },
+	},
+}
+
+// RegisterEncoder registers a constructor of Encoder under given name, the
+// name can then be used by NewEncoder and as the format of HandlerConfig
+//
+// "json" and "logfmt" are registered for JSONFormatter and LogfmtFormatter,
+// registering an existing name replaces it.
+func RegisterEncoder(name string, fn func() Encoder) {
+	encoders.Lock()
+	defer encoders.Unlock()
+	encoders.m[name] = fn
+}
+
+// NewEncoder creates an Encoder registered under given name
+func NewEncoder(name string) (Encoder, error) {
+	encoders.RLock()
+	fn, ok := encoders.m[name]
+	encoders.RUnlock()
+	if !ok {
+		return nil, errors.New("log: unknown encoder: " + name)
+	}
+	return fn(), nil
+}
+
+// Encoders returns the sorted names of registered encoders
+func Encoders() []string {
+	encoders.RLock()
+	defer encoders.RUnlock()
+	names := make([]string, 0, len(encoders.m))
+	for name := range encoders.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ErrNotFormatter is returned by SetFormat of a handler whose Encoder is not
+// a *Formatter
+var ErrNotFormatter = errors.New("log: encoder is not a Formatter")
+
+// handlerEncoder holds the Encoder of a handler, handlers of this package
+// embed it. Settings of Formatter are ignored unless the Encoder is a
+// *Formatter.
+type handlerEncoder struct {
+	enc       Encoder
+	formatter *Formatter
+}
+
+// SetEncoder sets the Encoder of output
+func (he *handlerEncoder) SetEncoder(e Encoder) {
+	he.enc = e
+	he.formatter, _ = e.(*Formatter)
+}
+
+// Encoder returns the Encoder of output
+func (he *handlerEncoder) Encoder() Encoder {
+	return he.enc
+}
+
+// Formatter returns the Encoder if it's a *Formatter, otherwise nil
+func (he *handlerEncoder) Formatter() *Formatter {
+	return he.formatter
+}
+
+// Format encodes the Record with the Encoder
+func (he *handlerEncoder) Format(r *Record) []byte {
+	return he.enc.AppendFormat(nil, r)
+}
+
+// appendEncoded appends the Record encoded by the Encoder to dst, newlines
+// are written as opts unless the Encoder is a single line one, see
+// SingleLineEncoder
+func (he *handlerEncoder) appendEncoded(dst []byte, r *Record, opts MultilineOptions) []byte {
+	start := len(dst)
+	dst = he.enc.AppendFormat(dst, r)
+	if sl, ok := he.enc.(SingleLineEncoder); ok && sl.SingleLine() {
+		return dst
+	}
+	return opts.apply(dst, start)
+}
+
+// SetFormat sets the format of the Formatter, ErrNotFormatter is returned if
+// the Encoder is not a *Formatter
+func (he *handlerEncoder) SetFormat(tpl string) error {
+	if he.formatter == nil {
+		return ErrNotFormatter
+	}
+	return he.formatter.SetFormat(tpl)
+}
+
+// SetTheme sets the colors of the Formatter, see Formatter.SetTheme
+func (he *handlerEncoder) SetTheme(t *Theme) {
+	if he.formatter != nil {
+		he.formatter.SetTheme(t)
+	}
+}
+
+// SetTimeOptions sets the time options of the Formatter, see
+// Formatter.SetTimeOptions
+func (he *handlerEncoder) SetTimeOptions(opts TimeOptions) {
+	if he.formatter != nil {
+		he.formatter.SetTimeOptions(opts)
+	}
+}
+
+// SetErrorHook sets the error hook of the Formatter, see
+// Formatter.SetErrorHook
+func (he *handlerEncoder) SetErrorHook(fn func(r *Record, err error)) {
+	if he.formatter != nil {
+		he.formatter.SetErrorHook(fn)
+	}
+}
+
+// Colored enable or disable the color function of the Formatter, usually
+// this is determined automatically, output of other Encoders is never colored
+//
+// When called with no argument, it returns the current state of color function
+func (he *handlerEncoder) Colored(ok ...bool) bool {
+	if he.formatter == nil {
+		return false
+	}
+	if len(ok) > 0 {
+		he.formatter.colored = ok[0]
+	}
+	return he.formatter.colored
+}
@@ -0,0 +1,103 @@
+package log
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func upperEncoder() Encoder {
+	return EncoderFunc(func(dst []byte, r *Record) []byte {
+		dst = append(dst, strings.ToUpper(r.Message())...)
+		return append(dst, '\n')
+	})
+}
+
+func TestSetEncoder(t *testing.T) {
+	ast := assert.New(t)
+	var buf bytes.Buffer
+	l := NewWithWriter("enc", nil)
+	h, _ := NewStreamHandler(&buf, "{{level}} {{}}")
+	l.AddHandler(h)
+	_, ok := h.Encoder().(*Formatter)
+	ast.True(ok)
+
+	h.SetEncoder(upperEncoder())
+	ast.Nil(h.Formatter())
+	ast.False(h.Colored())
+	l.Info("hello")
+	ast.Equal("HELLO\n", buf.String())
+
+	buf.Reset()
+	f, _ := NewFormatter("{{l}} {{}}", false)
+	h.SetEncoder(f)
+	ast.True(h.Formatter() == f)
+	l.Info("hello")
+	ast.Equal("I hello\n", buf.String())
+
+	buf.Reset()
+	h.SetEncoder(NewJSONFormatter())
+	l.Info("hello")
+	ast.Contains(buf.String(), `"message":"hello"`)
+}
+
+func TestHandlerWithoutFormatter(t *testing.T) {
+	ast := assert.New(t)
+	var buf bytes.Buffer
+	h := NewJSONStreamHandler(&buf)
+	ast.Nil(h.Formatter())
+	ast.Equal(ErrNotFormatter, h.SetFormat("{{}}"))
+	h.SetTheme(nil)
+	h.SetTimeOptions(TimeOptions{Location: time.UTC})
+	h.SetErrorHook(nil)
+	ast.False(h.Colored(true))
+	ast.Contains(string(h.Format(&Record{msg: "hi"})), `"message":"hi"`)
+
+	h.SetEncoder(upperEncoder())
+	ast.Equal("HI\n", string(h.Format(&Record{msg: "hi"})))
+	f, _ := NewFormatter("{{}}", false)
+	h.SetEncoder(f)
+	ast.NoError(h.SetFormat("{{l}} {{}}"))
+	ast.Equal("I hi\n", string(h.Format(&Record{lv: INFO, msg: "hi"})))
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	ast := assert.New(t)
+	_, err := NewEncoder("upper")
+	ast.EqualError(err, "log: unknown encoder: upper")
+
+	RegisterEncoder("upper", upperEncoder)
+	defer func() {
+		encoders.Lock()
+		delete(encoders.m, "upper")
+		encoders.Unlock()
+	}()
+	ast.Equal([]string{"json", "logfmt", "upper"}, Encoders())
+	e, err := NewEncoder("upper")
+	ast.NoError(err)
+	ast.Equal("HI\n", string(e.AppendFormat(nil, &Record{msg: "hi"})))
+
+	dir, err := ioutil.TempDir("", "log_encoder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer unregister("enc")
+	name := filepath.Join(dir, "upper.log")
+	err = Configure(strings.NewReader(`{
+		"handlers": {"upper": {"type": "file", "target": "` + name + `", "format": "upper"}},
+		"loggers": {"enc": {"handlers": ["upper"]}}
+	}`))
+	ast.NoError(err)
+	l := GetLogger("enc")
+	l.Info("configured")
+	ast.NoError(l.Close())
+	b, _ := ioutil.ReadFile(name)
+	ast.Equal("CONFIGURED\n", string(b))
+}
@@ -0,0 +1,70 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Field is a single key/value pair attached to a Record
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Fields is a set of key/value pairs, see Logger.WithFields
+type Fields map[string]interface{}
+
+// fieldsFromKV converts alternating keys and values into Fields, a key
+// without value gets nil as value
+func fieldsFromKV(kv []interface{}) []Field {
+	fs := make([]Field, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		var key string
+		if s, ok := kv[i].(string); ok {
+			key = s
+		} else {
+			key = fmt.Sprint(kv[i])
+		}
+		var value interface{}
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		fs = append(fs, Field{key, value})
+	}
+	return fs
+}
+
+// fieldsFromMap converts Fields into a slice sorted by key, so that the
+// output is stable
+func fieldsFromMap(m Fields) []Field {
+	fs := make([]Field, 0, len(m))
+	for k, v := range m {
+		fs = append(fs, Field{k, v})
+	}
+	sort.Sort(fieldsByKey(fs))
+	return fs
+}
+
+// mergeFields returns a new slice with fields in add appended to base, a key
+// already in base is updated in place
+func mergeFields(base, add []Field) []Field {
+	fs := make([]Field, len(base), len(base)+len(add))
+	copy(fs, base)
+outer:
+	for _, f := range add {
+		for i := range fs {
+			if fs[i].Key == f.Key {
+				fs[i].Value = f.Value
+				continue outer
+			}
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+type fieldsByKey []Field
+
+func (fs fieldsByKey) Len() int           { return len(fs) }
+func (fs fieldsByKey) Less(i, j int) bool { return fs[i].Key < fs[j].Key }
+func (fs fieldsByKey) Swap(i, j int)      { fs[i], fs[j] = fs[j], fs[i] }
@@ -0,0 +1,368 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateInterval indicates how often a FileHandler rotates by time
+type RotateInterval int
+
+const (
+	// RotateNever disables time based rotation
+	RotateNever RotateInterval = iota
+	// RotateHourly rotates at the first write of every hour
+	RotateHourly
+	// RotateDaily rotates at the first write of every day
+	RotateDaily
+)
+
+const backupTimeLayout = "2006-01-02T15-04-05.000"
+
+// rotateRetryDelay is the wait before retrying a failed rotation
+const rotateRetryDelay = time.Second
+
+var errFileHandlerClosed = errors.New("log: file handler is closed")
+
+// RotateOptions describes when and how a FileHandler rotates its file
+type RotateOptions struct {
+	// MaxSize rotates the file before it grows beyond MaxSize bytes, 0
+	// disables size based rotation
+	MaxSize int64
+	// Interval rotates the file when the hour or day changes
+	Interval RotateInterval
+	// Backups is the number of rotated files to keep, 0 keeps all of them
+	Backups int
+	// Compress gzips the rotated files
+	Compress bool
+	// OnError is called with errors of rotations triggered by writes, which
+	// do not fail the writes, they are written to os.Stderr if nil
+	OnError func(err error)
+}
+
+// FileHandler is a Handler which owns a file and rotates it by size or time
+//
+// Rotated files are named after the original one with the rotation time
+// appended, e.g. "app.log.2006-01-02T15-04-05.000", plus ".gz" if compressed.
+//
+// FileHandler is also the io.Writer returned by Writer, a rotation happens
+// inside a single Write, thus no record is lost or interleaved with either
+// sync or async output.
+type FileHandler struct {
+	handlerEncoder
+	multiline MultilineOptions
+	HandlerFilter
+
+	mu       sync.Mutex
+	filename string
+	opts     RotateOptions
+	file     *os.File
+	size     int64
+	period   time.Time
+	retry    time.Time
+	closed   bool
+	now      func() time.Time
+
+	// backupMu serializes compressing and removing backups, which are done
+	// in background after rotations triggered by writes, finishing counts
+	// them to be waited by Close
+	backupMu  sync.Mutex
+	finishing sync.WaitGroup
+}
+
+// NewFileHandler creates a FileHandler which appends to the given file with
+// given format string, the file is created if not exists
+func NewFileHandler(filename string, f string, opts RotateOptions) (*FileHandler, error) {
+	formatter, err := NewFormatter(f, false)
+	if err != nil {
+		return nil, err
+	}
+	h := &FileHandler{
+		filename: filename,
+		opts:     opts,
+		now:      time.Now,
+	}
+	h.SetEncoder(formatter)
+	if err := h.open(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Filename returns the name of the current file
+func (fh *FileHandler) Filename() string {
+	return fh.filename
+}
+
+// SetMultiline sets how newlines inside a formatted Record are written, raw
+// by default
+func (fh *FileHandler) SetMultiline(opts MultilineOptions) {
+	fh.multiline = opts
+}
+
+// Log writes the Record to the file, rotating it if necessary
+func (fh *FileHandler) Log(r *Record) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = fh.appendEncoded(*buf, r, fh.multiline)
+	writerLocks.Lock(fh)
+	defer writerLocks.Unlock(fh)
+	fh.Write(*buf)
+}
+
+// Writer returns the handler itself, which stays the same across rotations
+func (fh *FileHandler) Writer() io.Writer {
+	return fh
+}
+
+// Write writes p to the file, the file is rotated before writing if p
+// would exceed MaxSize or the rotation interval has passed
+//
+// p is written to whichever file is open even if the rotation fails, errors
+// of rotation are reported to RotateOptions.OnError. Rotated files are
+// compressed and old ones are removed in background, Close waits for them.
+func (fh *FileHandler) Write(p []byte) (int, error) {
+	fh.mu.Lock()
+	if fh.closed {
+		fh.mu.Unlock()
+		return 0, errFileHandlerClosed
+	}
+	var backup string
+	var rotateErr error
+	if fh.shouldRotate(len(p)) {
+		backup, rotateErr = fh.rotate()
+	}
+	if fh.file == nil {
+		if err := fh.open(); err != nil {
+			fh.mu.Unlock()
+			fh.reportError(rotateErr)
+			return 0, err
+		}
+	}
+	n, err := fh.file.Write(p)
+	fh.size += int64(n)
+	if backup != "" {
+		fh.finishing.Add(1)
+		go func() {
+			defer fh.finishing.Done()
+			fh.reportError(fh.finishRotation(backup))
+		}()
+	}
+	fh.mu.Unlock()
+
+	fh.reportError(rotateErr)
+	return n, err
+}
+
+// Rotate rotates the file immediately
+func (fh *FileHandler) Rotate() error {
+	fh.mu.Lock()
+	if fh.closed {
+		fh.mu.Unlock()
+		return errFileHandlerClosed
+	}
+	backup, err := fh.rotate()
+	fh.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return fh.finishRotation(backup)
+}
+
+func (fh *FileHandler) reportError(err error) {
+	if err == nil {
+		return
+	}
+	if fh.opts.OnError != nil {
+		fh.opts.OnError(err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "log: rotate "+fh.filename+":", err)
+}
+
+// Reopen closes and reopens the file, useful when the file is moved by
+// others
+func (fh *FileHandler) Reopen() error {
+	fh.mu.Lock()
+	defer fh.mu.Unlock()
+	if fh.file != nil {
+		fh.file.Close()
+		fh.file = nil
+	}
+	fh.closed = false
+	return fh.open()
+}
+
+// Close closes the file and waits until rotated files are compressed, writes
+// after Close fail until Reopen is called
+func (fh *FileHandler) Close() error {
+	fh.mu.Lock()
+	var err error
+	if !fh.closed && fh.file != nil {
+		err = fh.file.Close()
+	}
+	fh.closed = true
+	fh.mu.Unlock()
+	fh.finishing.Wait()
+	return err
+}
+
+func (fh *FileHandler) open() error {
+	f, err := os.OpenFile(fh.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	fh.file = f
+	fh.size = info.Size()
+	if fh.size > 0 {
+		fh.period = fh.periodOf(info.ModTime())
+	} else {
+		fh.period = fh.periodOf(fh.now())
+	}
+	return nil
+}
+
+func (fh *FileHandler) periodOf(t time.Time) time.Time {
+	switch fh.opts.Interval {
+	case RotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case RotateDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return time.Time{}
+}
+
+func (fh *FileHandler) shouldRotate(n int) bool {
+	if fh.size == 0 || fh.now().Before(fh.retry) {
+		return false
+	}
+	if fh.opts.MaxSize > 0 && fh.size+int64(n) > fh.opts.MaxSize {
+		return true
+	}
+	if fh.opts.Interval != RotateNever && !fh.periodOf(fh.now()).Equal(fh.period) {
+		return true
+	}
+	return false
+}
+
+// rotate renames the file to a backup and opens a new one, fh.mu must be
+// held. The name of backup is returned to be finished by finishRotation out
+// of fh.mu.
+//
+// If renaming fails, the original file is reopened and rotations are not
+// retried for rotateRetryDelay. fh.file is nil if the file can not be
+// reopened.
+func (fh *FileHandler) rotate() (string, error) {
+	if fh.file != nil {
+		fh.file.Close()
+		fh.file = nil
+	}
+	backup := fh.backupName(fh.now())
+	renameErr := os.Rename(fh.filename, backup)
+	if err := fh.open(); err != nil {
+		return "", err
+	}
+	if renameErr != nil {
+		fh.retry = fh.now().Add(rotateRetryDelay)
+		return "", renameErr
+	}
+	return backup, nil
+}
+
+// finishRotation compresses the backup if required and removes old backups
+func (fh *FileHandler) finishRotation(backup string) error {
+	fh.backupMu.Lock()
+	defer fh.backupMu.Unlock()
+	if fh.opts.Compress {
+		if err := compressFile(backup); err != nil {
+			return err
+		}
+	}
+	return fh.removeOldBackups()
+}
+
+// backupName returns an unused name for a rotated file at t
+func (fh *FileHandler) backupName(t time.Time) string {
+	for {
+		name := fh.filename + "." + t.Format(backupTimeLayout)
+		_, err := os.Stat(name)
+		_, errGz := os.Stat(name + ".gz")
+		if os.IsNotExist(err) && os.IsNotExist(errGz) {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// backups returns rotated files of fh from the oldest to the newest
+func (fh *FileHandler) backups() ([]string, error) {
+	matches, err := filepath.Glob(fh.filename + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, fh.filename+"."), ".gz")
+		if _, err := time.Parse(backupTimeLayout, stamp); err == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (fh *FileHandler) removeOldBackups() error {
+	if fh.opts.Backups <= 0 {
+		return nil
+	}
+	names, err := fh.backups()
+	if err != nil {
+		return err
+	}
+	for len(names) > fh.opts.Backups {
+		if err := os.Remove(names[0]); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// compressFile gzips name into name.gz and removes name
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,163 @@
+package log
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFileHandler(t *testing.T, opts RotateOptions) (*FileHandler, string) {
+	dir, err := ioutil.TempDir("", "log_file_handler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewFileHandler(filepath.Join(dir, "test.log"), "{{}}", opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return h, dir
+}
+
+func TestFileHandlerRotateBySize(t *testing.T) {
+	ast := assert.New(t)
+	h, dir := newTestFileHandler(t, RotateOptions{MaxSize: 10, Backups: 2})
+	defer os.RemoveAll(dir)
+	defer h.Close()
+
+	l := NewWithWriter("test", nil)
+	l.AddHandler(h)
+	for _, msg := range []string{"first", "second", "third", "fourth"} {
+		l.Info(msg)
+	}
+	h.finishing.Wait()
+
+	b, err := ioutil.ReadFile(h.Filename())
+	ast.NoError(err)
+	ast.Equal("fourth\n", string(b))
+
+	backups, err := h.backups()
+	ast.NoError(err)
+	ast.Len(backups, 2)
+	b, err = ioutil.ReadFile(backups[0])
+	ast.NoError(err)
+	ast.Equal("second\n", string(b))
+	b, err = ioutil.ReadFile(backups[1])
+	ast.NoError(err)
+	ast.Equal("third\n", string(b))
+}
+
+func TestFileHandlerRotateByTime(t *testing.T) {
+	ast := assert.New(t)
+	h, dir := newTestFileHandler(t, RotateOptions{Interval: RotateHourly, Compress: true})
+	defer os.RemoveAll(dir)
+	defer h.Close()
+
+	now := time.Date(2016, 1, 2, 3, 59, 0, 0, time.Local)
+	h.now = func() time.Time { return now }
+	h.Reopen()
+
+	l := NewWithWriter("test", nil)
+	l.AddHandler(h)
+	l.Info("before")
+	now = now.Add(30 * time.Second)
+	l.Info("same hour")
+	now = now.Add(time.Minute)
+	l.Info("next hour")
+	h.finishing.Wait()
+
+	b, err := ioutil.ReadFile(h.Filename())
+	ast.NoError(err)
+	ast.Equal("next hour\n", string(b))
+
+	backups, err := h.backups()
+	ast.NoError(err)
+	if ast.Len(backups, 1) {
+		ast.True(strings.HasSuffix(backups[0], ".2016-01-02T04-00-30.000.gz"), backups[0])
+		f, err := os.Open(backups[0])
+		ast.NoError(err)
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		ast.NoError(err)
+		b, err = ioutil.ReadAll(zr)
+		ast.NoError(err)
+		ast.Equal("before\nsame hour\n", string(b))
+	}
+}
+
+func TestFileHandlerRotateError(t *testing.T) {
+	ast := assert.New(t)
+	var errs []error
+	h, dir := newTestFileHandler(t, RotateOptions{
+		MaxSize: 10,
+		OnError: func(err error) { errs = append(errs, err) },
+	})
+	defer os.RemoveAll(dir)
+	defer h.Close()
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.Local)
+	h.now = func() time.Time { return now }
+
+	_, err := h.Write([]byte("first\n"))
+	ast.NoError(err)
+	// renaming fails as the file is gone, the record is written to a new file
+	ast.NoError(os.Remove(h.Filename()))
+	_, err = h.Write([]byte("second\n"))
+	ast.NoError(err)
+	ast.Len(errs, 1)
+
+	// no retry before rotateRetryDelay
+	_, err = h.Write([]byte("third\n"))
+	ast.NoError(err)
+	ast.Len(errs, 1)
+	b, _ := ioutil.ReadFile(h.Filename())
+	ast.Equal("second\nthird\n", string(b))
+
+	now = now.Add(rotateRetryDelay)
+	_, err = h.Write([]byte("fourth\n"))
+	ast.NoError(err)
+	ast.Len(errs, 1)
+	b, _ = ioutil.ReadFile(h.Filename())
+	ast.Equal("fourth\n", string(b))
+	h.finishing.Wait()
+	backups, _ := h.backups()
+	ast.Len(backups, 1)
+}
+
+func TestFileHandlerAsync(t *testing.T) {
+	ast := assert.New(t)
+	h, dir := newTestFileHandler(t, RotateOptions{MaxSize: 64})
+	defer os.RemoveAll(dir)
+	defer h.Close()
+
+	l := NewWithWriter("test", nil)
+	l.AddHandler(h)
+	l.SetAsync(true)
+	defer wSupervisor.Remove(h)
+	const n = 100
+	for i := 0; i < n; i++ {
+		l.Info("0123456789")
+	}
+
+	ast.NoError(l.Flush())
+	h.finishing.Wait()
+
+	lines := 0
+	names, _ := h.backups()
+	for _, name := range append(names, h.Filename()) {
+		b, _ := ioutil.ReadFile(name)
+		for _, line := range strings.SplitAfter(string(b), "\n") {
+			if line == "" {
+				continue
+			}
+			ast.Equal("0123456789\n", line)
+			lines++
+		}
+	}
+	ast.Equal(n, lines)
+}
@@ -0,0 +1,70 @@
+package log
+
+import "sync"
+
+// Filter decides whether a Record should be handled
+type Filter interface {
+	Filter(r *Record) bool
+}
+
+// FilterFunc is an adapter to use an ordinary function as Filter
+type FilterFunc func(r *Record) bool
+
+// Filter calls f(r)
+func (f FilterFunc) Filter(r *Record) bool {
+	return f(r)
+}
+
+// FilteredHandler is a Handler which decides by itself which Records to
+// handle, Logger.Output skips it for Records it does not accept
+type FilteredHandler interface {
+	Handler
+	Accept(r *Record) bool
+}
+
+// HandlerFilter holds the minimum level and filters of a handler, handlers
+// of this package embed it to implement FilteredHandler
+type HandlerFilter struct {
+	mu      sync.RWMutex
+	lv      LevelType
+	filters []Filter
+}
+
+// Level returns the minimum level of the handler, NOTSET by default which
+// accepts all levels
+func (hf *HandlerFilter) Level() LevelType {
+	hf.mu.RLock()
+	defer hf.mu.RUnlock()
+	return hf.lv
+}
+
+// SetLevel sets the minimum level of the handler
+func (hf *HandlerFilter) SetLevel(lv LevelType) {
+	hf.mu.Lock()
+	defer hf.mu.Unlock()
+	hf.lv = lv
+}
+
+// AddFilter adds a filter to the handler, a Record is handled only if all
+// filters return true
+func (hf *HandlerFilter) AddFilter(f Filter) {
+	hf.mu.Lock()
+	defer hf.mu.Unlock()
+	hf.filters = append(hf.filters, f)
+}
+
+// Accept returns true if the Record is at or above the level and accepted by
+// all filters
+func (hf *HandlerFilter) Accept(r *Record) bool {
+	hf.mu.RLock()
+	defer hf.mu.RUnlock()
+	if r.lv < hf.lv {
+		return false
+	}
+	for _, f := range hf.filters {
+		if !f.Filter(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -2,17 +2,26 @@ package log
 
 import (
 	"bytes"
+	"fmt"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 )
 
-// Formatter describes the format of outputting log
+// Formatter describes the format of outputting log, it is the default Encoder
+// of handlers
 type Formatter struct {
-	colored bool
-	tpl     *template.Template
+	colored  bool
+	onError  func(r *Record, err error)
+	palette  *palette
+	loc      *time.Location
+	layouts  timeLayouts
+	tpl      *template.Template
+	segments []segment
 }
 
 // NewFormatter creates a Formatter with given format string and whether to
@@ -20,16 +29,19 @@ type Formatter struct {
 func NewFormatter(format string, colored bool) (*Formatter, error) {
 	fm := new(Formatter)
 	fm.colored = colored
+	fm.layouts = defaultTimeLayouts
 	if err := fm.SetFormat(format); err != nil {
 		return nil, err
 	}
 	return fm, nil
 }
 
-var rTagLong = regexp.MustCompile("{{ *([a-zA-Z]+) *}}")
+var rTagLong = regexp.MustCompile("{{ *([a-zA-Z0-9_]+) *}}")
 var tagShort = []byte("{{$1}}")
+var rTagArg = regexp.MustCompile("{{ *(field|time) +")
+var tagArg = []byte("{{$1 . ")
 var tagReplacer = strings.NewReplacer(
-	"{{}}", "{{.String}}",
+	"{{}}", "{{message .}}",
 	"{{level}}", "{{level .}}",
 	"{{l}}", "{{l .}}",
 	"{{date}}", "{{date .}}",
@@ -42,6 +54,14 @@ var tagReplacer = strings.NewReplacer(
 	"{{rpc_id}}", "{{rpc_id .}}",
 	"{{request_id}}", "{{request_id .}}",
 	"{{app_id}}", "{{app_id .}}",
+	"{{fields}}", "{{fields .}}",
+	"{{stack}}", "{{stack .}}",
+
+	"{{iso8601}}", "{{iso8601 .}}",
+	"{{rfc3339nano}}", "{{rfc3339nano .}}",
+	"{{unix}}", "{{unix .}}",
+	"{{unix_ms}}", "{{unix_ms .}}",
+	"{{unix_ns}}", "{{unix_ns .}}",
 )
 
 // SetFormat set the format of outputting log
@@ -54,15 +74,39 @@ var tagReplacer = strings.NewReplacer(
 //	{{}}            The message provided by you e.g. l.Info(message)
 //	{{ level }}     Log level in four UPPER-CASED letters e.g. INFO, WARN
 //	{{ l }}         Log level in one UPPER-CASED letter e.g. I, W
-//	{{ data }}      Date in format "2006-01-02"
-//	{{ time }}      Time in format "15:04:05")
+//	{{ date }}      Date in format "2006-01-02"
+//	{{ time }}      Time in format "15:04:05"
 //	{{ datetime }}  Date and time in format "2006-01-02 15:04:05.999"
+//	{{ time "layout" }}  Time in the layout of package time
+//	{{ iso8601 }}   Time in format "2006-01-02T15:04:05.000Z07:00"
+//	{{ rfc3339nano }} Time in format time.RFC3339Nano
+//	{{ unix }}      Unix time in seconds
+//	{{ unix_ms }}   Unix time in milliseconds
+//	{{ unix_ns }}   Unix time in nanoseconds
 //	{{ name }}      Logger name
 //	{{ pid }}       Current process ID
 //	{{ file_line }} Filename and line number in format "file.go:12"
+//	{{ fields }}    All fields in format "key=value key2=value2"
+//	{{ field "k" }} Value of the field with key "k"
+//	{{ stack }}     Stack trace, see Logger.SetStackTrace
+//
+// Placeholders of empty values are rendered as "-", except {{ stack }} which
+// is rendered as nothing. Times are in the local time zone unless set by
+// SetTimeOptions.
+//
+// Besides placeholders, the format may use actions of text/template with the
+// methods of Record e.g. {{ .Name }}. Unknown placeholders and methods are
+// rejected with suggestions, errors of executing such formats are reported to
+// the hook set by SetErrorHook.
 func (f *Formatter) SetFormat(tpl string) error {
 	// {{ tag }} -> {{tag}}
 	tpl = string(rTagLong.ReplaceAll([]byte(tpl), tagShort))
+	format := tpl
+	if !strings.HasSuffix(format, "\n") {
+		format += "\n"
+	}
+	// {{ field "key" }} -> {{field . "key"}}
+	tpl = string(rTagArg.ReplaceAll([]byte(tpl), tagArg))
 
 	tpl = tagReplacer.Replace(tpl)
 
@@ -72,78 +116,187 @@ func (f *Formatter) SetFormat(tpl string) error {
 
 	t, err := template.New("tpl").Funcs(f.funcMap()).Parse(tpl)
 	if err != nil {
+		return parseError(err)
+	}
+	if err := validate(t.Tree.Root); err != nil {
 		return err
 	}
 
-	// TODO: validation
-
 	f.tpl = t
+	f.segments, _ = f.compile(format)
 	return nil
 }
 
+// SetErrorHook sets the function called with errors of executing the format
+// by text/template, the partially formatted Record is still written
+//
+// Errors are written to os.Stderr if no hook is set.
+func (f *Formatter) SetErrorHook(fn func(r *Record, err error)) {
+	f.onError = fn
+}
+
+func (f *Formatter) reportError(r *Record, err error) {
+	if f.onError != nil {
+		f.onError(r, err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "log: format error:", err)
+}
+
+// TimeOptions configures the time placeholders of Formatter
+type TimeOptions struct {
+	// Location converts the time of Records e.g. time.UTC, the time is kept
+	// in the local time zone if nil
+	Location *time.Location
+	// Fraction is the number of fractional second digits of {{ time }},
+	// {{ datetime }} and {{ iso8601 }}, which are padded with zeros to a
+	// fixed width. The defaults are kept if 0, i.e. none for {{ time }}, up
+	// to 3 digits without trailing zeros for {{ datetime }} and 3 digits for
+	// {{ iso8601 }}. At most 9 digits are rendered.
+	Fraction int
+}
+
+// timeLayouts are the layouts of time placeholders affected by TimeOptions
+type timeLayouts struct {
+	time, datetime, iso8601 string
+}
+
+var defaultTimeLayouts = timeLayouts{
+	time:     "15:04:05",
+	datetime: "2006-01-02 15:04:05.999",
+	iso8601:  "2006-01-02T15:04:05.000Z07:00",
+}
+
+// SetTimeOptions sets the time zone and fractional seconds of time
+// placeholders
+func (f *Formatter) SetTimeOptions(opts TimeOptions) {
+	f.loc = opts.Location
+	f.layouts = defaultTimeLayouts
+	if n := opts.Fraction; n > 0 {
+		if n > 9 {
+			n = 9
+		}
+		fraction := "." + strings.Repeat("0", n)
+		f.layouts.time = "15:04:05" + fraction
+		f.layouts.datetime = "2006-01-02 15:04:05" + fraction
+		f.layouts.iso8601 = "2006-01-02T15:04:05" + fraction + "Z07:00"
+	}
+}
+
+// timeOf returns the time of Record in the location of f
+func (f *Formatter) timeOf(r *Record) time.Time {
+	if f.loc == nil {
+		return r.now
+	}
+	return r.now.In(f.loc)
+}
+
 // Format formats a Record with set format
 func (f *Formatter) Format(r *Record) []byte {
-	var buf bytes.Buffer // TODO: use sync.Pool
-	f.tpl.Execute(&buf, r)
-	return buf.Bytes()
+	return f.AppendFormat(nil, r)
 }
 
-// TODO: the 'if color then paint' is ugly!!
+// AppendFormat appends the Record formatted with set format to dst and
+// returns the extended buffer
+//
+// Formats consisting of only plain text and placeholders are compiled and
+// appended without allocation, others are executed by text/template. Only
+// the formatting is free of allocation, logging still allocates the message
+// and the Record passed to handlers, see BenchmarkLogDiscard.
+func (f *Formatter) AppendFormat(dst []byte, r *Record) []byte {
+	if f.segments == nil {
+		buf := bytes.NewBuffer(dst)
+		if err := f.tpl.Execute(buf, r); err != nil {
+			f.reportError(r, err)
+		}
+		return buf.Bytes()
+	}
+	for _, seg := range f.segments {
+		if seg.name == "" {
+			dst = seg.append(dst, r)
+			continue
+		}
+		on, rst := f.style(seg.name, r.lv)
+		dst = append(dst, on...)
+		dst = seg.append(dst, r)
+		dst = append(dst, rst...)
+	}
+	return dst
+}
 
-func (f *Formatter) _level(r *Record) string {
-	s := LevelName[r.lv]
-	if f.colored {
-		s = f.paint(r.lv, s)
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 256)
+		return &b
+	},
+}
+
+func getBuffer() *[]byte {
+	b := bufferPool.Get().(*[]byte)
+	*b = (*b)[:0]
+	return b
+}
+
+func putBuffer(b *[]byte) {
+	// do not keep huge buffers
+	if cap(*b) <= 64<<10 {
+		bufferPool.Put(b)
 	}
-	return s
+}
+
+func (f *Formatter) _message(r *Record) string {
+	return f.paint("message", r.lv, r.msg)
+}
+
+func (f *Formatter) _level(r *Record) string {
+	return f.paint("level", r.lv, LevelName[r.lv])
 }
 
 func (f *Formatter) _l(r *Record) string {
-	s := LevelName[r.lv][0:1]
-	if f.colored {
-		s = f.paint(r.lv, s)
-	}
-	return s
+	return f.paint("l", r.lv, LevelName[r.lv][0:1])
 }
 
 func (f *Formatter) _datetime(r *Record) string {
-	s := r.now.Format("2006-01-02 15:04:05.999")
-	if f.colored {
-		s = f.paint(r.lv, s)
-	}
-	return s
+	return f.paint("datetime", r.lv, f.timeOf(r).Format(f.layouts.datetime))
 }
 
 func (f *Formatter) _date(r *Record) string {
-	s := r.now.Format("2006-01-02")
-	if f.colored {
-		s = f.paint(r.lv, s)
-	}
-	return s
+	return f.paint("date", r.lv, f.timeOf(r).Format("2006-01-02"))
 }
 
-func (f *Formatter) _time(r *Record) string {
-	s := r.now.Format("15:04:05")
-	if f.colored {
-		s = f.paint(r.lv, s)
+func (f *Formatter) _time(r *Record, layout ...string) string {
+	if len(layout) > 0 {
+		return f.paint("time", r.lv, f.timeOf(r).Format(layout[0]))
 	}
-	return s
+	return f.paint("time", r.lv, f.timeOf(r).Format(f.layouts.time))
+}
+
+func (f *Formatter) _iso8601(r *Record) string {
+	return f.paint("iso8601", r.lv, f.timeOf(r).Format(f.layouts.iso8601))
+}
+
+func (f *Formatter) _rfc3339nano(r *Record) string {
+	return f.paint("rfc3339nano", r.lv, f.timeOf(r).Format(time.RFC3339Nano))
+}
+
+func (f *Formatter) _unix(r *Record) string {
+	return f.paint("unix", r.lv, strconv.FormatInt(r.now.Unix(), 10))
+}
+
+func (f *Formatter) _unixMs(r *Record) string {
+	return f.paint("unix_ms", r.lv, strconv.FormatInt(r.now.UnixNano()/1e6, 10))
+}
+
+func (f *Formatter) _unixNs(r *Record) string {
+	return f.paint("unix_ns", r.lv, strconv.FormatInt(r.now.UnixNano(), 10))
 }
 
 func (f *Formatter) _name(r *Record) string {
-	s := r.name
-	if f.colored {
-		s = f.paint(r.lv, s)
-	}
-	return s
+	return f.paint("name", r.lv, r.name)
 }
 
 func (f *Formatter) _pid(r *Record) string {
-	s := strconv.Itoa(os.Getpid())
-	if f.colored {
-		s = f.paint(r.lv, s)
-	}
-	return s
+	return f.paint("pid", r.lv, strconv.Itoa(os.Getpid()))
 }
 
 func (f *Formatter) _rpcID(r *Record) string {
@@ -151,10 +304,7 @@ func (f *Formatter) _rpcID(r *Record) string {
 	if s == "" {
 		s = "-"
 	}
-	if f.colored {
-		s = f.paint(r.lv, s)
-	}
-	return s
+	return f.paint("rpc_id", r.lv, s)
 }
 
 func (f *Formatter) _requestID(r *Record) string {
@@ -162,10 +312,7 @@ func (f *Formatter) _requestID(r *Record) string {
 	if s == "" {
 		s = "-"
 	}
-	if f.colored {
-		s = f.paint(r.lv, s)
-	}
-	return s
+	return f.paint("request_id", r.lv, s)
 }
 
 func (f *Formatter) _appID(r *Record) string {
@@ -173,31 +320,66 @@ func (f *Formatter) _appID(r *Record) string {
 	if s == "" {
 		s = "-"
 	}
-	if f.colored {
-		s = f.paint(r.lv, s)
-	}
-	return s
+	return f.paint("app_id", r.lv, s)
 }
 
 func (f *Formatter) _fileLine(r *Record) string {
-	s := r.fileLine
-	for i := len(s) - 1; i >= 0; i-- {
-		if s[i] == '/' {
-			s = s[i+1:]
+	return f.paint("file_line", r.lv, shortFileLine(r.fileLine))
+}
+
+func (f *Formatter) _fields(r *Record) string {
+	if len(r.fields) == 0 {
+		return f.paint("fields", r.lv, "-")
+	}
+	var buf bytes.Buffer
+	for i, field := range r.fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(field.Key)
+		buf.WriteByte('=')
+		fmt.Fprint(&buf, field.Value)
+	}
+	return f.paint("fields", r.lv, buf.String())
+}
+
+func (f *Formatter) _field(r *Record, key string) string {
+	s := "-"
+	for _, field := range r.fields {
+		if field.Key == key {
+			s = fmt.Sprint(field.Value)
 			break
 		}
 	}
-	if f.colored {
-		s = f.paint(r.lv, s)
+	return f.paint("field", r.lv, s)
+}
+
+// shortFileLine strips the directory of a "/path/to/file.go:12"
+func shortFileLine(s string) string {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == '/' {
+			return s[i+1:]
+		}
 	}
 	return s
 }
 
+func (f *Formatter) _stack(r *Record) string {
+	return f.paint("stack", r.lv, r.stack)
+}
+
 func (f *Formatter) funcMap() template.FuncMap {
 	return template.FuncMap{
-		"date":      f._date,
-		"time":      f._time,
-		"datetime":  f._datetime,
+		"date":     f._date,
+		"time":     f._time,
+		"datetime": f._datetime,
+
+		"iso8601":     f._iso8601,
+		"rfc3339nano": f._rfc3339nano,
+		"unix":        f._unix,
+		"unix_ms":     f._unixMs,
+		"unix_ns":     f._unixNs,
+
 		"l":         f._l,
 		"level":     f._level,
 		"name":      f._name,
@@ -207,9 +389,20 @@ func (f *Formatter) funcMap() template.FuncMap {
 		"rpc_id":     f._rpcID,
 		"request_id": f._requestID,
 		"app_id":     f._appID,
+
+		"fields": f._fields,
+		"field":  f._field,
+		"stack":  f._stack,
+
+		"message": f._message,
 	}
 }
 
-func (f *Formatter) paint(lv LevelType, s string) string {
-	return painter(levelColor[lv], s)
+// paint paints s as the placeholder name of level lv if f is colored
+func (f *Formatter) paint(name string, lv LevelType, s string) string {
+	on, rst := f.style(name, lv)
+	if on == "" {
+		return s
+	}
+	return on + s + rst
 }
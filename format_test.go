@@ -0,0 +1,258 @@
+package log
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const allPlaceholders = `{{level}} {{ l }} {{date}} {{time}} {{datetime}} {{name}} {{pid}} ` +
+	`{{file_line}} {{rpc_id}} {{request_id}} {{app_id}} {{fields}} {{field "k"}} {{ field "x" }} {{stack}} {{}} ` +
+	`{{ time "Jan _2 15:04:05.000000" }} {{iso8601}} {{ rfc3339nano }} {{unix}} {{unix_ms}} {{ unix_ns }}`
+
+func testRecords() []*Record {
+	return []*Record{
+		{
+			fileLine: "/path/to/file.go:12",
+			name:     "test",
+			now:      time.Date(2016, 1, 2, 3, 4, 5, 60000000, time.Local),
+			lv:       INFO,
+			msg:      "message",
+		},
+		{
+			fileLine:  "file.go:1",
+			now:       time.Date(2016, 12, 31, 23, 59, 59, 0, time.Local),
+			lv:        FATA,
+			rpcID:     "rpc",
+			requestID: "req",
+			appID:     "app",
+			stack:     "main.main\n\t/path/to/main.go:3",
+			fields: []Field{
+				{"k", "v"}, {"int", -1}, {"uint8", uint8(2)}, {"float", 1.5e-10},
+				{"float32", float32(0.1)}, {"bool", true}, {"err", errors.New("oops")},
+				{"nil", nil}, {"slice", []int{1, 2}}, {"bytes", []byte("xy")},
+			},
+		},
+	}
+}
+
+func TestCompiledFormatIdentical(t *testing.T) {
+	ast := assert.New(t)
+	for _, colored := range []bool{false, true} {
+		for _, format := range []string{defaultTpl, syslogTpl, allPlaceholders, "{{}}\n"} {
+			compiled, err := NewFormatter(format, colored)
+			ast.NoError(err)
+			ast.NotNil(compiled.segments, format)
+			tpl, _ := NewFormatter(format, colored)
+			tpl.segments = nil
+
+			for _, r := range testRecords() {
+				ast.Equal(string(tpl.Format(r)), string(compiled.Format(r)))
+			}
+		}
+	}
+}
+
+func TestTemplateFallback(t *testing.T) {
+	ast := assert.New(t)
+	f, err := NewFormatter(`{{if eq .String "hi"}}greeting{{else}}{{level}}{{end}} {{printf "%q" .String}}`, false)
+	ast.NoError(err)
+	ast.Nil(f.segments)
+	r := testRecords()[0]
+	ast.Equal("INFO \"message\"\n", string(f.Format(r)))
+	r.msg = "hi"
+	ast.Equal("greeting \"hi\"\n", string(f.Format(r)))
+}
+
+func TestAppendFormatAllocs(t *testing.T) {
+	f, _ := NewFormatter(allPlaceholders, true)
+	r := testRecords()[0]
+	r.fields = []Field{{"k", "v"}, {"n", 42}}
+	buf := make([]byte, 0, 1024)
+	for _, theme := range []*Theme{nil, {Levels: map[LevelType]Style{INFO: {Fg: RGB(0, 255, 0)}}, MessageOnly: true}} {
+		f.SetTheme(theme)
+		allocs := testing.AllocsPerRun(100, func() {
+			buf = f.AppendFormat(buf[:0], r)
+		})
+		if allocs != 0 {
+			t.Errorf("Expected no allocation, got %v", allocs)
+		}
+	}
+}
+
+func TestFormatValidation(t *testing.T) {
+	ast := assert.New(t)
+	for format, msg := range map[string]string{
+		"{{lvel}} {{}}":            "log: unknown placeholder {{ lvel }}, did you mean {{ level }}?",
+		"{{ Level }}":              "log: unknown placeholder {{ Level }}, did you mean {{ level }}?",
+		`{{ feild "k" }}`:          "log: unknown placeholder {{ feild }}, did you mean {{ field }}?",
+		"{{ unix_mss }}":           "log: unknown placeholder {{ unix_mss }}, did you mean {{ unix_ms }}?",
+		"{{ whatever }}":           "log: unknown placeholder {{ whatever }}",
+		"{{ .Foo }}":               "log: unknown field .Foo of Record",
+		"{{ .Nmae }}":              "log: unknown field .Nmae of Record, did you mean .Name?",
+		"{{ if .Stak }}x{{ end }}": "log: unknown field .Stak of Record, did you mean .Stack?",
+		"{{ printf \"%s\" .Msg }}": "log: unknown field .Msg of Record",
+	} {
+		_, err := NewFormatter(format, false)
+		ast.EqualError(err, msg, format)
+	}
+
+	for _, format := range []string{
+		"{{ .Name }} {{ .Time.Unix }} {{ (.Time).Year }}",
+		"{{ range .Fields }}{{ .Key }}={{ .Value }} {{ end }}",
+		"{{ with .Fields }}{{ .Foo }}{{ else }}{{ .Message }}{{ end }}",
+	} {
+		_, err := NewFormatter(format, false)
+		ast.NoError(err, format)
+	}
+}
+
+func TestErrorHook(t *testing.T) {
+	ast := assert.New(t)
+	f, err := NewFormatter(`{{ level }} {{ index .Fields 5 }}`, false)
+	ast.NoError(err)
+	var errs []error
+	f.SetErrorHook(func(r *Record, err error) {
+		ast.Equal("message", r.Message())
+		errs = append(errs, err)
+	})
+	ast.Equal("INFO ", string(f.Format(testRecords()[0])))
+	if ast.Len(errs, 1) {
+		ast.Contains(errs[0].Error(), "index out of range")
+	}
+}
+
+func TestTimeOptions(t *testing.T) {
+	ast := assert.New(t)
+	r := testRecords()[0]
+	r.now = time.Date(2016, 1, 2, 3, 4, 5, 60000000, time.FixedZone("CST", 8*3600))
+	format := `{{date}} {{time}} {{datetime}} {{time "Jan _2 3PM"}} {{iso8601}} {{rfc3339nano}} {{unix}} {{unix_ms}} {{unix_ns}}`
+	for _, compiled := range []bool{true, false} {
+		f, err := NewFormatter(format, false)
+		ast.NoError(err)
+		ast.NotNil(f.segments)
+		if !compiled {
+			f.segments = nil
+		}
+		ast.Equal("2016-01-02 03:04:05 2016-01-02 03:04:05.06 Jan  2 3AM 2016-01-02T03:04:05.060+08:00 "+
+			"2016-01-02T03:04:05.06+08:00 1451675045 1451675045060 1451675045060000000\n", string(f.Format(r)))
+
+		f.SetTimeOptions(TimeOptions{Location: time.UTC, Fraction: 6})
+		ast.Equal("2016-01-01 19:04:05.060000 2016-01-01 19:04:05.060000 Jan  1 7PM 2016-01-01T19:04:05.060000Z "+
+			"2016-01-01T19:04:05.06Z 1451675045 1451675045060 1451675045060000000\n", string(f.Format(r)))
+
+		f.SetTimeOptions(TimeOptions{})
+		ast.Equal("2016-01-02 03:04:05 2016-01-02 03:04:05.06 Jan  2 3AM 2016-01-02T03:04:05.060+08:00 "+
+			"2016-01-02T03:04:05.06+08:00 1451675045 1451675045060 1451675045060000000\n", string(f.Format(r)))
+	}
+}
+
+func TestStyleSequence(t *testing.T) {
+	ast := assert.New(t)
+	ast.Equal("", Style{}.sequence())
+	ast.Equal("\x1b[1;31m", Style{Bold: true, Fg: Red}.sequence())
+	ast.Equal("\x1b[2;94;47m", Style{Dim: true, Fg: ANSIColor(12), Bg: White}.sequence())
+	ast.Equal("\x1b[3;4;38;5;208m", Style{Italic: true, Underline: true, Fg: Color256(208)}.sequence())
+	ast.Equal("\x1b[38;2;1;2;3;48;2;255;0;128m", Style{Fg: RGB(1, 2, 3), Bg: RGB(255, 0, 128)}.sequence())
+}
+
+func TestTheme(t *testing.T) {
+	ast := assert.New(t)
+	r := testRecords()[0]
+	theme := &Theme{
+		Levels:       map[LevelType]Style{INFO: {Fg: Green}},
+		Placeholders: map[string]Style{"name": {Dim: true}, "field": {Bold: true}},
+	}
+	for _, compiled := range []bool{true, false} {
+		f, _ := NewFormatter(`{{level}} {{name}} {{field "k"}} {{}}`, true)
+		if !compiled {
+			f.segments = nil
+		}
+		f.SetTheme(theme)
+		ast.Equal("\x1b[32mINFO\x1b[0m \x1b[2mtest\x1b[0m \x1b[1m-\x1b[0m message\n", string(f.Format(r)))
+
+		theme.MessageOnly = true
+		f.SetTheme(theme)
+		ast.Equal("INFO \x1b[2mtest\x1b[0m \x1b[1m-\x1b[0m \x1b[32mmessage\x1b[0m\n", string(f.Format(r)))
+		theme.MessageOnly = false
+
+		// levels without style are not painted
+		r.lv = DEBUG
+		ast.Equal("DEBUG \x1b[2mtest\x1b[0m \x1b[1m-\x1b[0m message\n", string(f.Format(r)))
+		r.lv = INFO
+
+		f.colored = false
+		ast.Equal("INFO test - message\n", string(f.Format(r)))
+
+		f.colored = true
+		f.SetTheme(nil)
+		ast.Equal(colorGreen+"INFO"+colorRST+" "+colorGreen+"test"+colorRST+" "+colorGreen+"-"+colorRST+" message\n",
+			string(f.Format(r)))
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	ast := assert.New(t)
+	for _, k := range []string{"NO_COLOR", "FORCE_COLOR", "TERM"} {
+		defer os.Setenv(k, os.Getenv(k))
+	}
+	for _, c := range []struct {
+		noColor, forceColor, term string
+		expected                  bool
+	}{
+		{"", "", "xterm", false},
+		{"", "1", "xterm", true},
+		{"", "true", "dumb", true},
+		{"", "0", "xterm", false},
+		{"1", "1", "xterm", false},
+		{"", "", "dumb", false},
+	} {
+		os.Setenv("NO_COLOR", c.noColor)
+		os.Setenv("FORCE_COLOR", c.forceColor)
+		os.Setenv("TERM", c.term)
+		ast.Equal(c.expected, ColorEnabled(ioutil.Discard), "%+v", c)
+		h, _ := NewStreamHandler(ioutil.Discard, "{{}}")
+		ast.Equal(c.expected, h.Colored())
+	}
+}
+
+func BenchmarkFormatCompiled(b *testing.B) {
+	f, _ := NewFormatter(defaultTpl, false)
+	r := testRecords()[0]
+	buf := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = f.AppendFormat(buf[:0], r)
+	}
+}
+
+func BenchmarkFormatTemplate(b *testing.B) {
+	f, _ := NewFormatter(defaultTpl, false)
+	f.segments = nil
+	r := testRecords()[0]
+	buf := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = f.AppendFormat(buf[:0], r)
+	}
+}
+
+// BenchmarkLogDiscard measures the whole logging path, which allocates for
+// the message, the caller and the Record besides the formatting measured by
+// BenchmarkFormatCompiled
+func BenchmarkLogDiscard(b *testing.B) {
+	l := NewWithWriter("test", nil)
+	h, _ := NewStreamHandler(ioutil.Discard, defaultTpl)
+	l.AddHandler(h)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("TEST_TEST_TEST")
+	}
+}
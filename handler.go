@@ -18,40 +18,48 @@ type Handler interface {
 
 // StreamHandler is a Handler of Stream writer e.g. console
 type StreamHandler struct {
-	writer io.Writer
-	*Formatter
+	writer    io.Writer
+	multiline MultilineOptions
+	handlerEncoder
+	HandlerFilter
 }
 
 // NewStreamHandler creates a StreamHandler with given writer(usually os.Stdout)
 // and format string, whether to color the output is determined by the type of
-// writer
+// writer and the environment, see ColorEnabled
 func NewStreamHandler(w io.Writer, f string) (*StreamHandler, error) {
 	h := new(StreamHandler)
 	h.writer = w
 
-	formatter, err := NewFormatter(f, IsTerminal(w))
-	h.Formatter = formatter
+	formatter, err := NewFormatter(f, ColorEnabled(w))
+	h.SetEncoder(formatter)
 
 	return h, err
 }
 
-// Colored enable or disable the color function of internal format, usually
-// this is determined automatically
-//
-// When called with no argument, it returns the current state of color function
-func (sw *StreamHandler) Colored(ok ...bool) bool {
-	if len(ok) > 0 {
-		sw.Formatter.colored = ok[0]
-	}
-	return sw.Formatter.colored
+// NewJSONStreamHandler creates a StreamHandler with given writer which writes
+// Records as JSON lines, see JSONFormatter
+func NewJSONStreamHandler(w io.Writer) *StreamHandler {
+	h := new(StreamHandler)
+	h.writer = w
+	h.SetEncoder(NewJSONFormatter())
+	return h
+}
+
+// SetMultiline sets how newlines inside a formatted Record are written, raw
+// by default
+func (sw *StreamHandler) SetMultiline(opts MultilineOptions) {
+	sw.multiline = opts
 }
 
 // Log print the Record to the internal writer
 func (sw *StreamHandler) Log(r *Record) {
-	b := sw.Formatter.Format(r)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = sw.appendEncoded(*buf, r, sw.multiline)
 	writerLocks.Lock(sw.writer)
 	defer writerLocks.Unlock(sw.writer)
-	sw.writer.Write(b)
+	sw.writer.Write(*buf)
 }
 
 // Writer return the writer
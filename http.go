@@ -0,0 +1,156 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// levelHTTPHandler serves levels of the global level and loggers in the
+// registry, see LevelHTTPHandler
+type levelHTTPHandler struct {
+	mu        sync.Mutex
+	reverts   map[string]*levelRevert
+	afterFunc func(d time.Duration, f func()) stopper
+}
+
+type levelRevert struct {
+	timer stopper
+	prev  LevelType
+}
+
+type levelJSON struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+	Own   string `json:"own"`
+}
+
+type levelsJSON struct {
+	Global  string      `json:"global"`
+	Loggers []levelJSON `json:"loggers"`
+}
+
+// globalTarget is the key of the global level in reverts, which is not a
+// valid logger name
+const globalTarget = "\x00global"
+
+// LevelHTTPHandler returns an http.Handler to inspect and change levels at
+// runtime, all responses are JSON:
+//
+//	GET /                                   global level and all loggers in the registry
+//	GET /?logger=svc.db                     level of logger "svc.db"
+//	PUT /?logger=svc.db&level=debug         set level of logger "svc.db"
+//	PUT /?level=debug&ttl=10m               set global level, reverted after 10 minutes
+//
+// The root logger is addressed by an empty name "?logger=", a logger must be
+// created by GetLogger before it can be addressed.
+func LevelHTTPHandler() http.Handler {
+	return &levelHTTPHandler{
+		reverts:   make(map[string]*levelRevert),
+		afterFunc: afterFunc,
+	}
+}
+
+func (h *levelHTTPHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	names, hasLogger := query["logger"]
+	var l *Logger
+	if hasLogger {
+		registry.Lock()
+		l = registry.m[names[0]]
+		registry.Unlock()
+		if l == nil {
+			http.Error(w, "unknown logger: "+names[0], http.StatusNotFound)
+			return
+		}
+	}
+
+	switch req.Method {
+	case "GET", "HEAD":
+	case "PUT":
+		lv, err := ParseLevel(query.Get("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var ttl time.Duration
+		if s := query.Get("ttl"); s != "" {
+			if ttl, err = time.ParseDuration(s); err != nil || ttl < 0 {
+				http.Error(w, "invalid ttl: "+s, http.StatusBadRequest)
+				return
+			}
+		}
+		if l == nil {
+			h.setLevel(globalTarget, lv, ttl, GlobalLevel, SetGlobalLevel)
+		} else {
+			h.setLevel(l.name, lv, ttl, l.ownLevel, l.SetLevel)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var v interface{}
+	switch {
+	case l != nil:
+		v = loggerLevelJSON(l)
+	case req.Method == "PUT":
+		v = levelsJSON{Global: levelString(GlobalLevel())}
+	default:
+		ls := Loggers()
+		levels := levelsJSON{
+			Global:  levelString(GlobalLevel()),
+			Loggers: make([]levelJSON, len(ls)),
+		}
+		for i, l := range ls {
+			levels.Loggers[i] = loggerLevelJSON(l)
+		}
+		v = levels
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// setLevel sets the level of target, which is reverted to the level before
+// the first pending ttl when ttl is positive
+func (h *levelHTTPHandler) setLevel(target string, lv LevelType, ttl time.Duration, get func() LevelType, set func(LevelType)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prev := get()
+	if r, ok := h.reverts[target]; ok {
+		r.timer.Stop()
+		prev = r.prev
+		delete(h.reverts, target)
+	}
+	set(lv)
+	if ttl <= 0 {
+		return
+	}
+	r := &levelRevert{prev: prev}
+	r.timer = h.afterFunc(ttl, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.reverts[target] == r {
+			set(r.prev)
+			delete(h.reverts, target)
+		}
+	})
+	h.reverts[target] = r
+}
+
+func loggerLevelJSON(l *Logger) levelJSON {
+	return levelJSON{
+		Name:  l.Name(),
+		Level: levelString(l.Level()),
+		Own:   levelString(l.ownLevel()),
+	}
+}
+
+func levelString(lv LevelType) string {
+	if lv == NOTSET {
+		return "NOTSET"
+	}
+	return LevelName[lv]
+}
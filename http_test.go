@@ -0,0 +1,67 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doLevelRequest(t *testing.T, h http.Handler, method, url string) (int, map[string]interface{}) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var v map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &v)
+	return rec.Code, v
+}
+
+func TestLevelHTTPHandler(t *testing.T) {
+	ast := assert.New(t)
+	h := LevelHTTPHandler()
+	clock := &fakeClock{now: time.Date(2016, 1, 2, 3, 4, 5, 0, time.Local)}
+	h.(*levelHTTPHandler).afterFunc = clock.AfterFunc
+	l := GetLogger("http.svc")
+	defer unregister("http", "http.svc")
+
+	code, v := doLevelRequest(t, h, "GET", "/")
+	ast.Equal(http.StatusOK, code)
+	ast.Equal("NOTSET", v["global"])
+	ast.NotEmpty(v["loggers"])
+
+	code, v = doLevelRequest(t, h, "GET", "/?logger=http.svc")
+	ast.Equal(http.StatusOK, code)
+	ast.Equal(map[string]interface{}{"name": "http.svc", "level": "INFO", "own": "NOTSET"}, v)
+
+	code, v = doLevelRequest(t, h, "PUT", "/?logger=http&level=debug")
+	ast.Equal(http.StatusOK, code)
+	ast.Equal(DEBUG, l.Level())
+
+	code, _ = doLevelRequest(t, h, "PUT", "/?logger=http.svc&level=verbose")
+	ast.Equal(http.StatusBadRequest, code)
+	code, _ = doLevelRequest(t, h, "PUT", "/?logger=http.svc&level=warning")
+	ast.Equal(http.StatusBadRequest, code)
+	code, _ = doLevelRequest(t, h, "GET", "/?logger=http.unknown")
+	ast.Equal(http.StatusNotFound, code)
+	code, _ = doLevelRequest(t, h, "DELETE", "/")
+	ast.Equal(http.StatusMethodNotAllowed, code)
+
+	code, v = doLevelRequest(t, h, "PUT", "/?level=warn&ttl=20ms")
+	ast.Equal(http.StatusOK, code)
+	ast.Equal("WARN", v["global"])
+	defer SetGlobalLevel(NOTSET)
+	clock.Add(10 * time.Millisecond)
+	code, v = doLevelRequest(t, h, "PUT", "/?level=erro&ttl=20ms")
+	ast.Equal("ERRO", v["global"])
+	// the first ttl is cancelled, the level before it is restored
+	clock.Add(10 * time.Millisecond)
+	ast.Equal(ERRO, GlobalLevel())
+	clock.Add(10 * time.Millisecond)
+	ast.Equal(NOTSET, GlobalLevel())
+}
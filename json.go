@@ -0,0 +1,147 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// JSONFormatter formats a Record as a single line of JSON object, the keys
+// are always present and in the following order:
+//
+//	{"level":"INFO","timestamp":"2006-01-02T15:04:05.999999999+08:00",
+//	"logger":"name","file_line":"file.go:12","pid":1234,"app_id":"",
+//	"rpc_id":"","request_id":"","message":"msg","fields":{"k":"v"}}
+//
+// "fields" is omitted if the Record has no field, "stack" is appended if a
+// stack trace is captured, see Logger.SetStackTrace.
+//
+// JSONFormatter is the Encoder registered as "json".
+type JSONFormatter struct{}
+
+// NewJSONFormatter creates a JSONFormatter
+func NewJSONFormatter() *JSONFormatter {
+	return new(JSONFormatter)
+}
+
+// Format formats a Record into JSON followed by a newline
+func (f *JSONFormatter) Format(r *Record) []byte {
+	return f.AppendFormat(make([]byte, 0, 256), r)
+}
+
+// SingleLine returns true as newlines are escaped in JSON strings
+func (f *JSONFormatter) SingleLine() bool {
+	return true
+}
+
+// AppendFormat appends the Record formatted into JSON to buf and returns the
+// extended buffer
+func (f *JSONFormatter) AppendFormat(buf []byte, r *Record) []byte {
+	buf = append(buf, `{"level":`...)
+	buf = appendJSONString(buf, LevelName[r.lv])
+	buf = append(buf, `,"timestamp":`...)
+	buf = appendJSONString(buf, r.now.Format(time.RFC3339Nano))
+	buf = append(buf, `,"logger":`...)
+	buf = appendJSONString(buf, r.name)
+	buf = append(buf, `,"file_line":`...)
+	buf = appendJSONString(buf, shortFileLine(r.fileLine))
+	buf = append(buf, `,"pid":`...)
+	buf = strconv.AppendInt(buf, int64(pid), 10)
+	buf = append(buf, `,"app_id":`...)
+	buf = appendJSONString(buf, r.appID)
+	buf = append(buf, `,"rpc_id":`...)
+	buf = appendJSONString(buf, r.rpcID)
+	buf = append(buf, `,"request_id":`...)
+	buf = appendJSONString(buf, r.requestID)
+	buf = append(buf, `,"message":`...)
+	buf = appendJSONString(buf, r.msg)
+	if len(r.fields) > 0 {
+		buf = append(buf, `,"fields":{`...)
+		for i, field := range r.fields {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSONString(buf, field.Key)
+			buf = append(buf, ':')
+			buf = appendJSONValue(buf, field.Value)
+		}
+		buf = append(buf, '}')
+	}
+	if r.stack != "" {
+		buf = append(buf, `,"stack":`...)
+		buf = appendJSONString(buf, r.stack)
+	}
+	buf = append(buf, '}', '\n')
+	return buf
+}
+
+// appendJSONValue appends v encoded by encoding/json, values which can not be
+// encoded are appended as strings in the manner of fmt.Sprint
+func appendJSONValue(buf []byte, v interface{}) []byte {
+	switch vv := v.(type) {
+	case string:
+		return appendJSONString(buf, vv)
+	case error:
+		return appendJSONString(buf, vv.Error())
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return appendJSONString(buf, fmt.Sprint(v))
+	}
+	return append(buf, b...)
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString appends s as a quoted JSON string, control characters are
+// escaped and invalid UTF-8 is replaced by U+FFFD
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				buf = append(buf, '\\', b)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028 and U+2029 are line terminators in JavaScript
+		if c == '\u2028' || c == '\u2029' {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hex[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf = append(buf, s[start:]...)
+	buf = append(buf, '"')
+	return buf
+}
@@ -0,0 +1,75 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONFormatterSchema(t *testing.T) {
+	ast := assert.New(t)
+	now := time.Date(2016, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	r := &Record{
+		fileLine:  "/path/to/file.go:12",
+		name:      "test",
+		now:       now,
+		lv:        WARN,
+		msg:       "hello",
+		rpcID:     "rpc",
+		requestID: "req",
+		appID:     "app",
+	}
+	expected := `{"level":"WARN","timestamp":"2016-01-02T03:04:05.006Z","logger":"test",` +
+		`"file_line":"file.go:12","pid":` + strconv.Itoa(os.Getpid()) + `,"app_id":"app",` +
+		`"rpc_id":"rpc","request_id":"req","message":"hello"}` + "\n"
+	ast.Equal(expected, string(NewJSONFormatter().Format(r)))
+
+	r.fields = []Field{{"user_id", 42}, {"err", os.ErrNotExist}, {"tags", []string{"a"}}}
+	expected = expected[:len(expected)-2] + `,"fields":{"user_id":42,"err":"file does not exist","tags":["a"]}}` + "\n"
+	ast.Equal(expected, string(NewJSONFormatter().Format(r)))
+}
+
+func TestJSONFormatterEscaping(t *testing.T) {
+	ast := assert.New(t)
+	cases := map[string]string{
+		`say "hi"`:          `"say \"hi\""`,
+		`C:\dir`:            `"C:\\dir"`,
+		"line1\nline2\r\t":  `"line1\nline2\r\t"`,
+		"bell\x07":          `"bell\u0007"`,
+		"<html>&":           `"<html>&"`,
+		"中文":                `"中文"`,
+		"bad\xffutf8":       `"bad\ufffdutf8"`,
+		"js\u2028separator": `"js\u2028separator"`,
+	}
+	for in, expected := range cases {
+		ast.Equal(expected, string(appendJSONString(nil, in)))
+
+		var out string
+		ast.NoError(json.Unmarshal([]byte(expected), &out))
+	}
+}
+
+func TestJSONStreamHandler(t *testing.T) {
+	ast := assert.New(t)
+	var buf bytes.Buffer
+	l := NewWithWriter("json", nil)
+	l.AddHandler(NewJSONStreamHandler(&buf))
+	SetGlobalAppID("test.appid")
+	defer SetGlobalAppID("")
+
+	l.With("k", "v").Info("multi\nline")
+
+	var m map[string]interface{}
+	ast.NoError(json.Unmarshal(buf.Bytes(), &m))
+	ast.Equal("INFO", m["level"])
+	ast.Equal("json", m["logger"])
+	ast.Equal("test.appid", m["app_id"])
+	ast.Equal("multi\nline", m["message"])
+	ast.Equal(map[string]interface{}{"k": "v"}, m["fields"])
+	ast.Equal(1, bytes.Count(buf.Bytes(), []byte("\n")))
+}
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 )
@@ -32,8 +34,11 @@ const (
 	FATA
 )
 
+// FlushTimeout is the longest time Flush waits for async records
+var FlushTimeout = 5 * time.Second
+
 var (
-	globalLevel = NOTSET
+	globalLevel = int32(NOTSET) // accessed atomically
 	logLevel    string
 	globalAppID = ""
 )
@@ -75,6 +80,11 @@ type Logger struct {
 	rpcID     string
 	requestID string
 	async     bool
+	queue     *QueueOptions
+	fields    []Field
+	parent    *Logger
+	stack     StackOptions
+	sampler   *sampler
 }
 
 // New creates a Logger with Stdout as default output
@@ -106,12 +116,12 @@ func NewRPCLogger(name string) RPCLogger {
 
 // SetGlobalLevel sets the global log level
 func SetGlobalLevel(lv LevelType) {
-	globalLevel = lv
+	atomic.StoreInt32(&globalLevel, int32(lv))
 }
 
 // GlobalLevel returns the global log level
 func GlobalLevel() LevelType {
-	return globalLevel
+	return LevelType(atomic.LoadInt32(&globalLevel))
 }
 
 // SetGlobalAppID sets the global AppID
@@ -119,6 +129,23 @@ func SetGlobalAppID(appID string) {
 	globalAppID = appID
 }
 
+// Flush waits until async records of all loggers are written, or
+// ErrFlushTimeout is returned after FlushTimeout
+func Flush() error {
+	return wSupervisor.Flush(nil, FlushTimeout)
+}
+
+// SetHandlerQueueOptions sets the options of the async queue of the writer
+// of given handler, which take precedence over options of loggers
+func SetHandlerQueueOptions(h Handler, opts QueueOptions) {
+	wSupervisor.Configure(h.Writer(), opts)
+}
+
+// Stats returns the stats of all async queues
+func Stats() QueueStats {
+	return wSupervisor.Stats(nil)
+}
+
 // AttachFlagSet attaches a flag to the given FlagSet indicating the global log level
 //
 // Passing nil flagSet for default FlagSet(flag.CommandLine)
@@ -131,12 +158,22 @@ func AttachFlagSet(flagSet *flag.FlagSet) {
 
 // ParseFlag should be used after AttachFlagSet
 func ParseFlag() error {
-	lvl, ok := levelFlag[strings.ToLower(logLevel)]
-	if ok {
-		globalLevel = lvl
-		return nil
+	lvl, err := ParseLevel(logLevel)
+	if err != nil {
+		return err
 	}
-	return errors.New("unknown log level")
+	SetGlobalLevel(lvl)
+	return nil
+}
+
+// ParseLevel parses a case-insensitive level name, one of "debug", "info",
+// "warn", "erro" and "fata"
+func ParseLevel(s string) (LevelType, error) {
+	s = strings.ToLower(s)
+	if lv, ok := levelFlag[s]; ok {
+		return lv, nil
+	}
+	return NOTSET, errors.New("unknown log level: " + s)
 }
 
 // Name returns the name of logger
@@ -166,6 +203,38 @@ func (l *Logger) Handlers() []Handler {
 	return hs
 }
 
+// SetHandlers replaces all handlers of logger atomically, the replaced
+// handlers are returned
+func (l *Logger) SetHandlers(hs ...Handler) []Handler {
+	l.Lock()
+	defer l.Unlock()
+	return l.setHandlers(hs)
+}
+
+// setHandlers replaces all handlers, l must be locked
+func (l *Logger) setHandlers(hs []Handler) []Handler {
+	old := make([]Handler, 0, len(l.handlers))
+	for h := range l.handlers {
+		old = append(old, h)
+	}
+	l.handlers = make(map[Handler]bool, len(hs))
+	for _, h := range hs {
+		l.handlers[h] = true
+	}
+	return old
+}
+
+// effectiveHandlers returns handlers of logger, or those of the nearest
+// ancestor if logger has no handler
+func (l *Logger) effectiveHandlers() []Handler {
+	for lg := l; lg != nil; lg = lg.parent {
+		if hs := lg.Handlers(); len(hs) > 0 || lg.parent == nil {
+			return hs
+		}
+	}
+	return nil
+}
+
 // RemoveHandler removes a handler
 func (l *Logger) RemoveHandler(h Handler) {
 	l.Lock()
@@ -175,25 +244,32 @@ func (l *Logger) RemoveHandler(h Handler) {
 
 // Level returns the current level of logger
 //
-// logger.SetLevel is always authoritative, GlobalLevel is used if SetLevel is
-// not called, otherwise defaultLevel is used.
+// logger.SetLevel is always authoritative, levels of ancestors are used if
+// SetLevel is not called, then GlobalLevel, otherwise defaultLevel is used.
 //
 // Level() search priority:
 //	1. logger's own level (if set)
-//	2. GlobalLevel (if set)
-//	3. defaultLevel (built-in, usually INFO)
+//	2. level of the nearest ancestor (if set), see GetLogger
+//	3. GlobalLevel (if set)
+//	4. defaultLevel (built-in, usually INFO)
 func (l *Logger) Level() LevelType {
-	l.RLock()
-	defer l.RUnlock()
-	if l.lv != NOTSET {
-		return l.lv
+	for lg := l; lg != nil; lg = lg.parent {
+		if lv := lg.ownLevel(); lv != NOTSET {
+			return lv
+		}
 	}
-	if globalLevel != NOTSET {
-		return globalLevel
+	if lv := GlobalLevel(); lv != NOTSET {
+		return lv
 	}
 	return defaultLevel
 }
 
+func (l *Logger) ownLevel() LevelType {
+	l.RLock()
+	defer l.RUnlock()
+	return l.lv
+}
+
 // SetLevel set the level of logger
 //
 // SetLevel is always authoritative, See also logger.Level()
@@ -231,6 +307,52 @@ func (l *Logger) RequestID() string {
 	return l.requestID
 }
 
+// With returns a child logger with the given alternating keys and values
+// attached to every Record it logs, e.g.
+//
+//	l.With("user_id", 42, "order_id", "E1024").Info("paid")
+//
+// The child starts with a copy of the IDs of l. Until they are set on the
+// child, its level and handlers are those of l at the time of logging, just
+// like a logger inherits them from its parent, see GetLogger.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	return l.withFields(fieldsFromKV(kv))
+}
+
+// WithFields is just like With but takes a map of fields, which are attached
+// in the order of their keys
+func (l *Logger) WithFields(fields Fields) *Logger {
+	return l.withFields(fieldsFromMap(fields))
+}
+
+func (l *Logger) withFields(fs []Field) *Logger {
+	l.RLock()
+	defer l.RUnlock()
+	return &Logger{
+		name:      l.name,
+		lv:        NOTSET,
+		tpl:       l.tpl,
+		handlers:  make(map[Handler]bool),
+		rpcID:     l.rpcID,
+		requestID: l.requestID,
+		async:     l.async,
+		queue:     l.queue,
+		fields:    mergeFields(l.fields, fs),
+		parent:    l,
+		stack:     l.stack,
+		sampler:   l.sampler,
+	}
+}
+
+// Fields returns the fields attached to logger
+func (l *Logger) Fields() []Field {
+	l.RLock()
+	defer l.RUnlock()
+	fs := make([]Field, len(l.fields))
+	copy(fs, l.fields)
+	return fs
+}
+
 // SetAsync set output as async
 func (l *Logger) SetAsync(async bool) {
 	l.Lock()
@@ -238,13 +360,85 @@ func (l *Logger) SetAsync(async bool) {
 	l.async = async
 }
 
+// SetQueueOptions sets the options of async queues used by logger, options
+// set by SetHandlerQueueOptions take precedence
+//
+// The size of a queue is decided by the first logger using it.
+func (l *Logger) SetQueueOptions(opts QueueOptions) {
+	l.Lock()
+	defer l.Unlock()
+	l.queue = &opts
+}
+
+// QueueStats returns the stats of async queues used by handlers of logger
+func (l *Logger) QueueStats() QueueStats {
+	return wSupervisor.Stats(l.writers())
+}
+
+func (l *Logger) writers() []io.Writer {
+	hs := l.effectiveHandlers()
+	writers := make([]io.Writer, 0, len(hs))
+	for _, h := range hs {
+		writers = append(writers, h.Writer())
+	}
+	return writers
+}
+
+// Flush waits until async records of logger are written, or ErrFlushTimeout
+// is returned after FlushTimeout
+func (l *Logger) Flush() error {
+	return wSupervisor.Flush(l.writers(), FlushTimeout)
+}
+
+// Close flushes the logger and closes all handlers which implement
+// io.Closer, e.g. FileHandler
+func (l *Logger) Close() error {
+	err := l.Flush()
+	for _, h := range l.Handlers() {
+		if c, ok := h.(io.Closer); ok {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
 // Output writes a log to all writers with given calldepth and level
 //
 // Normally, you won't need this.
 func (l *Logger) Output(calldepth int, lv LevelType, s string) {
+	l.output(calldepth+1, lv, "", s, nil)
+}
+
+// output is Output with the format string of s if any, and rpcID, requestID
+// and fields carried by ctx, which may be nil
+func (l *Logger) output(calldepth int, lv LevelType, tpl string, s string, ctx context.Context) {
 	if lv < l.Level() {
 		return
 	}
+	r := l.newRecord(calldepth+1, lv, s, ctx)
+	r.tpl = tpl
+
+	l.RLock()
+	smp := l.sampler
+	l.RUnlock()
+	if smp != nil && !smp.Allow(r) {
+		return
+	}
+
+	l.RLock()
+	stack := l.stack
+	l.RUnlock()
+	if stack.Level != NOTSET && lv >= stack.Level {
+		r.stack = captureStack(calldepth, stack)
+	}
+
+	l.dispatch(r)
+}
+
+// newRecord creates a Record of logger with the caller of given calldepth
+func (l *Logger) newRecord(calldepth int, lv LevelType, s string, ctx context.Context) *Record {
 	fileLine := ""
 	_, file, line, ok := runtime.Caller(calldepth)
 	if !ok {
@@ -263,29 +457,74 @@ func (l *Logger) Output(calldepth int, lv LevelType, s string) {
 		rpcID:     l.rpcID,
 		requestID: l.requestID,
 		appID:     globalAppID,
+		fields:    l.fields,
+	}
+	l.RUnlock()
+
+	if ctx != nil {
+		if v, ok := ctx.Value(contextKey{}).(*contextValues); ok {
+			if v.rpcID != "" {
+				r.rpcID = v.rpcID
+			}
+			if v.requestID != "" {
+				r.requestID = v.requestID
+			}
+			if len(v.fields) > 0 {
+				r.fields = mergeFields(r.fields, v.fields)
+			}
+		}
+	}
+	return r
+}
+
+// dispatch passes the Record to all handlers accepting it
+//
+// The logger owning the handlers is read locked until the Record is passed,
+// so handlers replaced by SetHandlers or ApplyConfig are not in use once the
+// replacement returns.
+func (l *Logger) dispatch(r *Record) {
+	l.RLock()
+	async, queue := l.async, l.queue
+	l.RUnlock()
+
+	lg := l
+	for {
+		lg.RLock()
+		if len(lg.handlers) > 0 || lg.parent == nil {
+			break
+		}
+		lg.RUnlock()
+		lg = lg.parent
 	}
+	defer lg.RUnlock()
 
-	if l.async {
-		for h := range l.handlers {
-			// for loop variable bug
-			hh := h
-			wSupervisor.Do(h.Writer(), func() {
-				hh.Log(r)
-			})
+	hs := make([]Handler, 0, len(lg.handlers))
+	for h := range lg.handlers {
+		if fh, ok := h.(FilteredHandler); ok && !fh.Accept(r) {
+			continue
+		}
+		hs = append(hs, h)
+	}
+	if async {
+		for _, h := range hs {
+			wSupervisor.Do(h, r, queue)
 		}
-		l.RUnlock()
+		return
+	}
+
+	if len(hs) == 1 {
+		hs[0].Log(r)
 		return
 	}
 
 	var wg sync.WaitGroup
-	for h := range l.handlers {
+	for _, h := range hs {
 		wg.Add(1)
 		go func(h Handler, r *Record) {
 			defer wg.Done()
 			h.Log(r)
 		}(h, r)
 	}
-	l.RUnlock()
 	wg.Wait()
 }
 
@@ -298,7 +537,7 @@ func (l *Logger) Debug(a ...interface{}) {
 
 // Debugf calls Output to log with DEBUG level and given format
 func (l *Logger) Debugf(format string, a ...interface{}) {
-	l.Output(2, DEBUG, fmt.Sprintf(format, a...))
+	l.output(2, DEBUG, format, fmt.Sprintf(format, a...), nil)
 }
 
 // Print APIs
@@ -315,7 +554,7 @@ func (l *Logger) Println(a ...interface{}) {
 
 // Printf calls Output to log with default level and given format
 func (l *Logger) Printf(f string, a ...interface{}) {
-	l.Output(2, l.Level(), fmt.Sprintf(f, a...))
+	l.output(2, l.Level(), f, fmt.Sprintf(f, a...), nil)
 }
 
 // Info APIs
@@ -327,7 +566,7 @@ func (l *Logger) Info(a ...interface{}) {
 
 // Infof calls Output to log with INFO level and given format
 func (l *Logger) Infof(f string, a ...interface{}) {
-	l.Output(2, INFO, fmt.Sprintf(f, a...))
+	l.output(2, INFO, f, fmt.Sprintf(f, a...), nil)
 }
 
 // Warn APIs
@@ -339,7 +578,7 @@ func (l *Logger) Warn(a ...interface{}) {
 
 // Warnf calls Output to log with WARN level and given format
 func (l *Logger) Warnf(f string, a ...interface{}) {
-	l.Output(2, WARN, fmt.Sprintf(f, a...))
+	l.output(2, WARN, f, fmt.Sprintf(f, a...), nil)
 }
 
 // Error APIs
@@ -351,19 +590,23 @@ func (l *Logger) Error(a ...interface{}) {
 
 // Errorf calls Output to log with ERRO level and given format
 func (l *Logger) Errorf(f string, a ...interface{}) {
-	l.Output(2, ERRO, fmt.Sprintf(f, a...))
+	l.output(2, ERRO, f, fmt.Sprintf(f, a...), nil)
 }
 
 // Fatal APIs
 
-// Fatal calls Output to log with FATA level followed by a call to os.Exit(1)
+// Fatal calls Output to log with FATA level followed by a call to os.Exit(1),
+// async records are flushed before exiting
 func (l *Logger) Fatal(a ...interface{}) {
 	l.Output(2, FATA, fmt.Sprint(a...))
+	l.Flush()
 	os.Exit(1)
 }
 
-// Fatalf calls Output to log with FATA level with given format, followed by a call to os.Exit(1)
+// Fatalf calls Output to log with FATA level with given format, followed by a call to os.Exit(1),
+// async records are flushed before exiting
 func (l *Logger) Fatalf(f string, a ...interface{}) {
-	l.Output(2, FATA, fmt.Sprintf(f, a...))
+	l.output(2, FATA, f, fmt.Sprintf(f, a...), nil)
+	l.Flush()
 	os.Exit(1)
 }
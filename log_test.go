@@ -2,9 +2,14 @@ package log
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -28,10 +33,11 @@ func TestFileLine(t *testing.T) {
 	l.AddHandler(hdr)
 	SetGlobalAppID("samaritan.test")
 	defer SetGlobalAppID("")
+	_, _, line, _ := runtime.Caller(0)
 	l.Info("TEST_TEST")
 
 	strs := strings.Split(buf.String(), " ")
-	if strs[4] != "log_test.go:31" {
+	if strs[4] != "log_test.go:"+strconv.Itoa(line+1) {
 		t.Errorf("FileLine Error: %s", buf.String())
 	}
 }
@@ -48,6 +54,14 @@ func newLogger(t *testing.T, w io.Writer, f string) SimpleLogger {
 	return l
 }
 
+// removeWorkers removes the async workers of handlers of l, so that later
+// tests do not flush them
+func removeWorkers(l SimpleLogger) {
+	for _, h := range l.(*Logger).Handlers() {
+		wSupervisor.Remove(h.Writer())
+	}
+}
+
 type fakeWriter struct {
 	writed chan bool
 	buf    *bytes.Buffer
@@ -102,6 +116,211 @@ outer:
 	}
 }
 
+type slowWriter struct {
+	sync.Mutex
+	delay time.Duration
+	buf   bytes.Buffer
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	w.Lock()
+	defer w.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *slowWriter) String() string {
+	w.Lock()
+	defer w.Unlock()
+	return w.buf.String()
+}
+
+func TestFlush(t *testing.T) {
+	ast := assert.New(t)
+	w := new(slowWriter)
+	l := newLogger(t, w, "{{}}")
+	l.SetAsync(true)
+	defer removeWorkers(l)
+	for i := 0; i < 10; i++ {
+		l.Info(i)
+	}
+	ast.NoError(l.(*Logger).Flush())
+	ast.Equal("0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n", w.String())
+
+	g := newGateWriter()
+	slow := newLogger(t, g, "{{}}")
+	slow.SetAsync(true)
+	defer removeWorkers(slow)
+	slow.Info("slow")
+	<-g.started
+	defer func(d time.Duration) { FlushTimeout = d }(FlushTimeout)
+	FlushTimeout = time.Millisecond
+	// the writer is blocked until released
+	ast.Equal(ErrFlushTimeout, Flush())
+	close(g.release)
+	FlushTimeout = time.Minute
+	ast.NoError(Flush())
+	ast.Equal("slow\n", g.String())
+}
+
+// gateWriter blocks every Write until it is released
+type gateWriter struct {
+	slowWriter
+	started chan bool
+	release chan bool
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{
+		started: make(chan bool, 100),
+		release: make(chan bool),
+	}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	w.started <- true
+	<-w.release
+	return w.slowWriter.Write(p)
+}
+
+func testOverflow(t *testing.T, opts QueueOptions, expected string, stats QueueStats) {
+	w := newGateWriter()
+	l := newLogger(t, w, "{{}}")
+	l.SetAsync(true)
+	defer removeWorkers(l)
+	SetHandlerQueueOptions(l.Handlers()[0], opts)
+
+	l.Info(1)
+	<-w.started
+	l.Info(2)
+	l.Info(3)
+	close(w.release)
+
+	ast := assert.New(t)
+	ast.NoError(l.(*Logger).Flush())
+	ast.Equal(expected, w.String())
+	ast.Equal(stats, l.(*Logger).QueueStats())
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	testOverflow(t, QueueOptions{Size: 1, Policy: DropNewest}, "1\n2\n", QueueStats{2, 1, 2})
+	testOverflow(t, QueueOptions{Size: 1, Policy: DropOldest}, "1\n3\n", QueueStats{3, 1, 2})
+	testOverflow(t, QueueOptions{Size: 1, Policy: BlockTimeout, Timeout: time.Millisecond}, "1\n2\n", QueueStats{2, 1, 2})
+}
+
+func TestOverflowDropOldestFlush(t *testing.T) {
+	ast := assert.New(t)
+	w := newGateWriter()
+	l := newLogger(t, w, "{{}}").(*Logger)
+	l.SetAsync(true)
+	defer removeWorkers(l)
+	h := l.Handlers()[0]
+	SetHandlerQueueOptions(h, QueueOptions{Size: 2, Policy: DropOldest})
+	worker := wSupervisor.worker(h.Writer(), nil)
+
+	l.Info(1)
+	<-w.started
+	// queue a flush mark as Flush does
+	done := make(chan struct{})
+	worker.ch <- writerJob{done: done}
+	// the flush mark is taken out of the full queue but not dropped
+	l.Info(2)
+	l.Info(3)
+	select {
+	case <-done:
+		t.Error("Flush should wait for queued records")
+	default:
+	}
+	close(w.release)
+	<-done
+	ast.NoError(l.Flush())
+	ast.Equal("1\n3\n", w.String())
+	ast.Equal(QueueStats{3, 1, 2}, l.QueueStats())
+}
+
+func TestRemoveWorker(t *testing.T) {
+	ast := assert.New(t)
+	w := &slowWriter{delay: time.Millisecond}
+	l := newLogger(t, w, "{{}}").(*Logger)
+	l.SetAsync(true)
+	for i := 0; i < 3; i++ {
+		l.Info(i)
+	}
+	worker := wSupervisor.worker(w, nil)
+	wSupervisor.Remove(w)
+	<-worker.stopped
+	ast.Equal("0\n1\n2\n", w.String())
+	ast.Empty(wSupervisor.workers([]io.Writer{w}))
+	ast.NoError(Flush())
+}
+
+func TestOverflowBlock(t *testing.T) {
+	w := newGateWriter()
+	l := newLogger(t, w, "{{}}")
+	l.SetAsync(true)
+	defer removeWorkers(l)
+	l.(*Logger).SetQueueOptions(QueueOptions{Size: 1, Policy: Block})
+	worker := wSupervisor.worker(l.(*Logger).Handlers()[0].Writer(), nil)
+
+	l.Info(1)
+	<-w.started
+	l.Info(2)
+	logged := make(chan bool)
+	go func() {
+		l.Info(3)
+		logged <- true
+	}()
+	// the queue stays full while the writer is blocked
+	select {
+	case <-logged:
+		t.Error("Info should block when the queue is full")
+	default:
+	}
+	ast := assert.New(t)
+	ast.Equal(uint64(2), worker.Stats().Enqueued)
+	close(w.release)
+	<-logged
+
+	ast.NoError(l.(*Logger).Flush())
+	ast.Equal("1\n2\n3\n", w.String())
+	ast.Equal(QueueStats{3, 0, 3}, l.(*Logger).QueueStats())
+}
+
+func TestDropReport(t *testing.T) {
+	ast := assert.New(t)
+	w := newGateWriter()
+	l := newLogger(t, w, "{{level}} {{app_id}} {{}}").(*Logger)
+	l.SetAsync(true)
+	defer removeWorkers(l)
+
+	tick := make(chan time.Time)
+	worker := newWriterWorker(QueueOptions{Size: 1})
+	worker.tick = tick
+	wSupervisor.mu.Lock()
+	wSupervisor.m[w] = worker
+	wSupervisor.mu.Unlock()
+	worker.Start()
+
+	SetGlobalAppID("app")
+	l.Info(1)
+	<-w.started
+	l.Info(2)
+	l.Info(3)
+	l.Info(4)
+	// the report carries the app id of the records, not the current one
+	SetGlobalAppID("")
+	close(w.release)
+	ast.NoError(l.Flush())
+	tick <- time.Now()
+	ast.NoError(l.Flush())
+	ast.Equal("INFO app 1\nINFO app 2\nWARN app dropped 2 records\n", w.String())
+
+	// nothing is reported if no records were dropped since last report
+	tick <- time.Now()
+	ast.NoError(l.Flush())
+	ast.Equal("INFO app 1\nINFO app 2\nWARN app dropped 2 records\n", w.String())
+}
+
 func TestGlobalLevel(t *testing.T) {
 	expected := "W: WarnLog\n"
 	var b bytes.Buffer
@@ -147,6 +366,72 @@ func TestLevel(t *testing.T) {
 	}
 }
 
+func TestHandlerFilter(t *testing.T) {
+	var all, errs bytes.Buffer
+	l := newLogger(t, &all, "{{l}}: {{}}")
+	l.SetLevel(DEBUG)
+	h, _ := NewStreamHandler(&errs, "{{l}}: {{}}")
+	h.SetLevel(ERRO)
+	h.AddFilter(FilterFunc(func(r *Record) bool {
+		return !strings.Contains(r.String(), "ignored")
+	}))
+	l.AddHandler(h)
+
+	l.Debug("DebugLog")
+	l.Warn("WarnLog")
+	l.Error("ErrorLog")
+	l.Error("ErrorLog ignored")
+
+	expected := "D: DebugLog\nW: WarnLog\nE: ErrorLog\nE: ErrorLog ignored\n"
+	if all.String() != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, all.String())
+	}
+	expected = "E: ErrorLog\n"
+	if errs.String() != expected {
+		t.Errorf("Expected:\n%v\nGot:\n%v", expected, errs.String())
+	}
+}
+
+type recordHandler struct {
+	records []*Record
+}
+
+func (h *recordHandler) Log(r *Record) {
+	h.records = append(h.records, r)
+}
+
+func (h *recordHandler) Writer() io.Writer {
+	return ioutil.Discard
+}
+
+func TestRecordAccessors(t *testing.T) {
+	ast := assert.New(t)
+	h := new(recordHandler)
+	l := NewWithWriter("test", nil)
+	l.AddHandler(h)
+	l.SetRPCID("rpc")
+	l.SetRequestID("req")
+	SetGlobalAppID("app")
+	defer SetGlobalAppID("")
+
+	before := time.Now()
+	_, _, line, _ := runtime.Caller(0)
+	l.With("k", "v").Warn("WarnLog")
+	if !ast.Len(h.records, 1) {
+		return
+	}
+	r := h.records[0]
+	ast.Equal(WARN, r.Level())
+	ast.False(r.Time().Before(before))
+	ast.Equal("test", r.Name())
+	ast.True(strings.HasSuffix(r.Caller(), "/log_test.go:"+strconv.Itoa(line+1)), r.Caller())
+	ast.Equal("rpc", r.RPCID())
+	ast.Equal("req", r.RequestID())
+	ast.Equal("app", r.AppID())
+	ast.Equal("WarnLog", r.Message())
+	ast.Equal([]Field{{"k", "v"}}, r.Fields())
+}
+
 func TestGlobalAppID(t *testing.T) {
 	var buf bytes.Buffer
 	l := newLogger(t, &buf, "[{{app_id}}] ## {{}}")
@@ -208,6 +493,422 @@ func TestSetRequestID(t *testing.T) {
 	}
 }
 
+func TestWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithWriter("test", nil)
+	h, _ := NewStreamHandler(&buf, "{{fields}} [{{ field \"user_id\" }}] {{}}")
+	h.Colored(false)
+	l.AddHandler(h)
+
+	l.Info("InfoLog")
+	expected := "- [-] InfoLog\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	child := l.With("user_id", 42, "order_id", "E1024").WithFields(Fields{"user_id": 7, "amount": 1.5})
+	child.Info("InfoLog")
+	expected = "user_id=7 order_id=E1024 amount=1.5 [7] InfoLog\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	l.Info("InfoLog")
+	expected = "- [-] InfoLog\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestContext(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(t, &buf, "[{{rpc_id}} {{request_id}}] {{fields}} {{file_line}} {{}}").(*Logger)
+	l.SetRPCID("shared.rpcid")
+	l = l.With("k", "v")
+
+	ctx := NewContext(context.Background(), "ctx.rpcid", "ctx.request_id", "user_id", 42)
+	ctx = NewContext(ctx, "", "", "k", "ctx")
+	rpcID, requestID, fields := FromContext(ctx)
+	assert.Equal(t, "ctx.rpcid", rpcID)
+	assert.Equal(t, "ctx.request_id", requestID)
+	assert.Equal(t, []Field{{"user_id", 42}, {"k", "ctx"}}, fields)
+
+	_, _, line, _ := runtime.Caller(0)
+	l.InfoCtx(ctx, "InfoLog")
+	expected := fmt.Sprintf("[ctx.rpcid ctx.request_id] k=ctx user_id=42 log_test.go:%d InfoLog\n", line+1)
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	_, _, line, _ = runtime.Caller(0)
+	l.Info("InfoLog")
+	expected = fmt.Sprintf("[shared.rpcid -] k=v log_test.go:%d InfoLog\n", line+1)
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	ast := assert.New(t)
+	h := new(recordHandler)
+	l := NewWithWriter("test", nil)
+	l.AddHandler(h)
+	l.SetStackTrace(StackOptions{Level: ERRO, Depth: 2, TrimPrefixes: []string{"github.com/eleme/"}})
+
+	l.Warn("WarnLog")
+	_, file, line, _ := runtime.Caller(0)
+	l.Error("ErrorLog")
+	if !ast.Len(h.records, 2) {
+		return
+	}
+	ast.Equal("", h.records[0].Stack())
+	lines := strings.Split(h.records[1].Stack(), "\n")
+	ast.Len(lines, 4)
+	ast.Equal("log.TestStackTrace", lines[0])
+	ast.Equal("\t"+file+":"+strconv.Itoa(line+1), lines[1])
+
+	var buf bytes.Buffer
+	fh, _ := NewStreamHandler(&buf, "{{}}\n{{stack}}")
+	fh.Colored(false)
+	fh.Log(h.records[1])
+	ast.Equal("ErrorLog\n"+h.records[1].Stack()+"\n", buf.String())
+}
+
+func TestRecover(t *testing.T) {
+	ast := assert.New(t)
+	h := new(recordHandler)
+	l := NewWithWriter("test", nil)
+	l.AddHandler(h)
+
+	var line int
+	func() {
+		defer l.Recover()
+		_, _, line, _ = runtime.Caller(0)
+		panic("boom")
+	}()
+	func() {
+		defer l.LogPanic(PanicOptions{Level: FATA})
+		var m map[string]int
+		m["nil"] = 1
+	}()
+	ast.Panics(func() {
+		defer l.LogPanic(PanicOptions{Action: PanicRepanic})
+		panic("again")
+	})
+
+	if !ast.Len(h.records, 3) {
+		return
+	}
+	ast.Equal(ERRO, h.records[0].Level())
+	ast.Equal("panic: boom", h.records[0].String())
+	ast.True(strings.HasSuffix(h.records[0].Caller(), "/log_test.go:"+strconv.Itoa(line+1)), h.records[0].Caller())
+	ast.True(strings.HasPrefix(h.records[0].Stack(), "github.com/eleme/log.TestRecover.func1\n"), h.records[0].Stack())
+	ast.Equal(FATA, h.records[1].Level())
+	ast.Equal("panic: assignment to entry in nil map", h.records[1].String())
+	ast.True(strings.HasPrefix(h.records[1].Stack(), "github.com/eleme/log.TestRecover.func2\n"), h.records[1].Stack())
+	ast.Equal("panic: again", h.records[2].String())
+}
+
+func TestRecoverHandler(t *testing.T) {
+	ast := assert.New(t)
+	h := new(recordHandler)
+	l := NewWithWriter("test", nil)
+	l.AddHandler(h)
+	handler := l.RecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("boom")
+	}), PanicOptions{})
+
+	req, _ := http.NewRequest("GET", "/path", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	ast.Equal(http.StatusInternalServerError, rec.Code)
+	if ast.Len(h.records, 1) {
+		ast.Equal("panic: boom", h.records[0].String())
+		ast.Equal([]Field{{"method", "GET"}, {"url", "/path"}}, h.records[0].Fields())
+	}
+
+	handler = l.RecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		panic("late")
+	}), PanicOptions{})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	ast.Equal(http.StatusAccepted, rec.Code)
+	ast.Equal("partial", rec.Body.String())
+	if ast.Len(h.records, 2) {
+		ast.Equal("panic: late", h.records[1].String())
+	}
+}
+
+// fakeClock is a clock of sampler advanced by tests
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	stopped := t.stopped
+	t.stopped = true
+	return !stopped
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) stopper {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Add advances the clock by d and runs the expired timers
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var expired []*fakeTimer
+	n := 0
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			c.timers[n] = t
+			n++
+		} else {
+			expired = append(expired, t)
+		}
+	}
+	c.timers = c.timers[:n]
+	c.mu.Unlock()
+	for _, t := range expired {
+		if !t.stopped {
+			t.stopped = true
+			t.f()
+		}
+	}
+}
+
+func TestSampling(t *testing.T) {
+	w := new(slowWriter)
+	l := newLogger(t, w, "{{l}} {{}}").(*Logger)
+	l.SetSampling(SamplingOptions{Interval: 50 * time.Millisecond, First: 2, Thereafter: 3})
+	clock := &fakeClock{now: time.Date(2016, 1, 2, 3, 4, 5, 0, time.Local)}
+	l.sampler.now = clock.Now
+	l.sampler.afterFunc = clock.AfterFunc
+	for i := 1; i <= 10; i++ {
+		l.Errorf("hot %d", i)
+	}
+	l.Error("cold")
+
+	expected := "E hot 1\nE hot 2\nE hot 5\nE hot 8\nE cold\n"
+	if w.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, w.String())
+	}
+	clock.Add(49 * time.Millisecond)
+	if w.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, w.String())
+	}
+	clock.Add(time.Millisecond)
+	expected += "E suppressed 6 similar messages\n"
+	if w.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, w.String())
+	}
+
+	for i := 11; i <= 13; i++ {
+		l.Errorf("hot %d", i)
+	}
+	clock.Add(50 * time.Millisecond)
+	l.Errorf("hot %d", 14)
+	expected += "E hot 11\nE hot 12\nE suppressed 1 similar messages\nE hot 14\n"
+	if w.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, w.String())
+	}
+}
+
+func TestSampledHandler(t *testing.T) {
+	w := new(slowWriter)
+	l := NewWithWriter("test", nil)
+	h, _ := NewStreamHandler(w, "{{}}")
+	l.AddHandler(NewSampledHandler(h, SamplingOptions{Interval: time.Hour, First: 1}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Info("same")
+		}()
+	}
+	wg.Wait()
+	if w.String() != "same\n" {
+		t.Errorf("Expected:\nsame\nGot:\n%s", w.String())
+	}
+}
+
+func TestRingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithWriter("test", nil)
+	l.SetLevel(DEBUG)
+	h, _ := NewStreamHandler(&buf, "{{l}} {{}}")
+	h.Colored(false)
+	l.AddHandler(NewRingHandler(h, RingOptions{Size: 3}))
+
+	for i := 1; i <= 4; i++ {
+		l.Debug("d", i)
+	}
+	l.Info("i1")
+	l.Error("e1")
+	l.Debug("d5")
+	l.Error("e2")
+
+	expected := "I i1\nD d2\nD d3\nD d4\nE e1\nD d5\nE e2\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRingHandlerPerRequest(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithWriter("test", nil)
+	l.SetLevel(DEBUG)
+	h, _ := NewStreamHandler(&buf, "{{request_id}} {{}}")
+	h.Colored(false)
+	l.AddHandler(NewRingHandler(h, RingOptions{Size: 10, PerRequest: true, MaxRequests: 2}))
+
+	a := NewContext(context.Background(), "", "a")
+	b := NewContext(context.Background(), "", "b")
+	c := NewContext(context.Background(), "", "c")
+	l.DebugCtx(a, "a1")
+	l.DebugCtx(b, "b1")
+	l.DebugCtx(a, "a2")
+	l.ErrorCtx(b, "b2")
+	l.DebugCtx(c, "c1")
+	l.DebugCtx(b, "b3")
+	l.ErrorCtx(a, "a3")
+
+	expected := "b b1\nb b2\na a3\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRingHandlerEvictOldest(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithWriter("test", nil)
+	l.SetLevel(DEBUG)
+	h, _ := NewStreamHandler(&buf, "{{request_id}} {{}}")
+	h.Colored(false)
+	l.AddHandler(NewRingHandler(h, RingOptions{Size: 10, PerRequest: true, MaxRequests: 2}))
+
+	a := NewContext(context.Background(), "", "a")
+	b := NewContext(context.Background(), "", "b")
+	c := NewContext(context.Background(), "", "c")
+	l.DebugCtx(a, "a1")
+	l.ErrorCtx(a, "a2")
+	l.DebugCtx(b, "b1")
+	l.DebugCtx(a, "a3")
+	// b is the oldest ring now
+	l.DebugCtx(c, "c1")
+	l.ErrorCtx(a, "a4")
+	l.ErrorCtx(b, "b2")
+
+	expected := "a a1\na a2\na a3\na a4\nb b2\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRingHandlerEvictLeastRecentlyUsed(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithWriter("test", nil)
+	l.SetLevel(DEBUG)
+	h, _ := NewStreamHandler(&buf, "{{request_id}} {{}}")
+	h.Colored(false)
+	l.AddHandler(NewRingHandler(h, RingOptions{Size: 10, PerRequest: true, MaxRequests: 2}))
+
+	a := NewContext(context.Background(), "", "a")
+	b := NewContext(context.Background(), "", "b")
+	c := NewContext(context.Background(), "", "c")
+	l.DebugCtx(a, "a1")
+	l.DebugCtx(b, "b1")
+	l.DebugCtx(a, "a2")
+	// b is the least recently used ring although a was created first
+	l.DebugCtx(c, "c1")
+	l.ErrorCtx(a, "a3")
+	l.ErrorCtx(b, "b2")
+
+	expected := "a a1\na a2\na a3\nb b2\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRingHandlerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWithWriter("test", nil)
+	l.SetLevel(DEBUG)
+	h, _ := NewStreamHandler(&buf, "{{l}} {{}}")
+	h.Colored(false)
+	h.SetLevel(WARN)
+	l.AddHandler(NewRingHandler(h, RingOptions{Size: 3}))
+
+	l.Debug("d1")
+	l.Info("i1")
+	l.Warn("w1")
+	l.Error("e1")
+
+	expected := "W w1\nE e1\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRingHandlerFlushOrdered(t *testing.T) {
+	w := &slowWriter{delay: time.Millisecond}
+	l := NewWithWriter("test", nil)
+	l.SetLevel(DEBUG)
+	h, _ := NewStreamHandler(w, "{{request_id}} {{}}")
+	l.AddHandler(NewRingHandler(h, RingOptions{Size: 10, PerRequest: true}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			ctx := NewContext(context.Background(), "", id)
+			l.DebugCtx(ctx, "d1")
+			l.DebugCtx(ctx, "d2")
+			l.InfoCtx(ctx, "i")
+			l.ErrorCtx(ctx, "e")
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(w.String()), "\n")
+	for i, line := range lines {
+		if !strings.HasSuffix(line, " d1") {
+			continue
+		}
+		id := strings.TrimSuffix(line, " d1")
+		if i+2 >= len(lines) || lines[i+1] != id+" d2" || lines[i+2] != id+" e" {
+			t.Errorf("Flushed records of %s are interleaved:\n%s", id, w.String())
+		}
+	}
+}
+
 func TestTemplate(t *testing.T) {
 	expected := `long: INFO
 short: I
@@ -316,7 +1017,7 @@ func BenchmarkDate(b *testing.B) {
 	}
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		hdr._date(r)
+		hdr.Formatter()._date(r)
 	}
 }
 
@@ -335,7 +1036,7 @@ func BenchmarkTime(b *testing.B) {
 	}
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		hdr._time(r)
+		hdr.Formatter()._time(r)
 	}
 }
 
@@ -0,0 +1,168 @@
+package log
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// LogfmtFormatter formats a Record as a single line of logfmt, i.e. space
+// separated key=value pairs in the following order:
+//
+//	level=INFO ts=2006-01-02T15:04:05.999999999+08:00 logger=name
+//	caller=file.go:12 app_id=app rpc_id=1.2 request_id=abc msg="hello world"
+//
+// app_id, rpc_id and request_id are omitted if empty, fields follow msg as
+// key=value pairs and "stack" is appended if a stack trace is captured.
+//
+// Values are quoted if empty or containing spaces, '=', '"' or control
+// characters, and escaped in quotes in the same way as JSON strings, except
+// that DEL and C1 control characters are escaped as well. Invalid characters
+// of field keys are replaced by '_'.
+//
+// LogfmtFormatter is the Encoder registered as "logfmt".
+type LogfmtFormatter struct{}
+
+// NewLogfmtFormatter creates a LogfmtFormatter
+func NewLogfmtFormatter() *LogfmtFormatter {
+	return new(LogfmtFormatter)
+}
+
+// Format formats a Record into logfmt followed by a newline
+func (f *LogfmtFormatter) Format(r *Record) []byte {
+	return f.AppendFormat(make([]byte, 0, 256), r)
+}
+
+// SingleLine returns true as newlines are escaped in quoted values
+func (f *LogfmtFormatter) SingleLine() bool {
+	return true
+}
+
+// AppendFormat appends the Record formatted into logfmt to buf and returns
+// the extended buffer
+func (f *LogfmtFormatter) AppendFormat(buf []byte, r *Record) []byte {
+	buf = append(buf, "level="...)
+	buf = append(buf, LevelName[r.lv]...)
+	buf = append(buf, " ts="...)
+	buf = r.now.AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, " logger="...)
+	buf = appendLogfmtString(buf, r.name)
+	buf = append(buf, " caller="...)
+	buf = appendLogfmtString(buf, shortFileLine(r.fileLine))
+	if r.appID != "" {
+		buf = append(buf, " app_id="...)
+		buf = appendLogfmtString(buf, r.appID)
+	}
+	if r.rpcID != "" {
+		buf = append(buf, " rpc_id="...)
+		buf = appendLogfmtString(buf, r.rpcID)
+	}
+	if r.requestID != "" {
+		buf = append(buf, " request_id="...)
+		buf = appendLogfmtString(buf, r.requestID)
+	}
+	buf = append(buf, " msg="...)
+	buf = appendLogfmtString(buf, r.msg)
+	for _, field := range r.fields {
+		buf = append(buf, ' ')
+		buf = appendLogfmtKey(buf, field.Key)
+		buf = append(buf, '=')
+		buf = appendLogfmtValue(buf, field.Value)
+	}
+	if r.stack != "" {
+		buf = append(buf, " stack="...)
+		buf = appendLogfmtString(buf, r.stack)
+	}
+	buf = append(buf, '\n')
+	return buf
+}
+
+// appendLogfmtKey appends key with invalid characters replaced by '_'
+func appendLogfmtKey(buf []byte, key string) []byte {
+	if key == "" {
+		return append(buf, '_')
+	}
+	for i := 0; i < len(key); i++ {
+		if b := key[i]; logfmtUnsafe(b) || b >= utf8.RuneSelf {
+			buf = append(buf, '_')
+		} else {
+			buf = append(buf, b)
+		}
+	}
+	return buf
+}
+
+// appendLogfmtValue appends v in the manner of fmt.Sprint, quoted if needed
+func appendLogfmtValue(buf []byte, v interface{}) []byte {
+	if s, ok := v.(string); ok {
+		return appendLogfmtString(buf, s)
+	}
+	start := len(buf)
+	buf = appendValue(buf, v)
+	return appendLogfmtString(buf[:start], string(buf[start:]))
+}
+
+// appendLogfmtString appends s, quoted if needed
+func appendLogfmtString(buf []byte, s string) []byte {
+	if logfmtNeedsQuote(s) {
+		return appendLogfmtQuoted(buf, s)
+	}
+	return append(buf, s...)
+}
+
+// appendLogfmtQuoted appends s quoted as a JSON string, with DEL and C1
+// control characters, which JSON leaves as they are, escaped as \u00XX
+func appendLogfmtQuoted(buf []byte, s string) []byte {
+	start := len(buf)
+	buf = appendJSONString(buf, s)
+	if !hasDELOrC1(buf[start:]) {
+		return buf
+	}
+	tmp := getBuffer()
+	defer putBuffer(tmp)
+	*tmp = append(*tmp, buf[start:]...)
+	buf = buf[:start]
+	// the quoted string is valid UTF-8, thus 0xc2 is always a leading byte
+	for q, i := *tmp, 0; i < len(q); i++ {
+		switch b := q[i]; {
+		case b == 0x7f:
+			buf = append(buf, `\u007f`...)
+		case isC1(q[i:]):
+			buf = append(buf, '\\', 'u', '0', '0', hex[q[i+1]>>4], hex[q[i+1]&0xF])
+			i++
+		default:
+			buf = append(buf, b)
+		}
+	}
+	return buf
+}
+
+// isC1 returns true if b starts with a C1 control character in UTF-8, i.e.
+// U+0080 to U+009F
+func isC1(b []byte) bool {
+	return len(b) > 1 && b[0] == 0xc2 && b[1] >= 0x80 && b[1] <= 0x9f
+}
+
+func hasDELOrC1(b []byte) bool {
+	for i := range b {
+		if b[i] == 0x7f || isC1(b[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func logfmtNeedsQuote(s string) bool {
+	if s == "" || !utf8.ValidString(s) {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		if logfmtUnsafe(s[i]) || s[i] == 0xc2 && i+1 < len(s) && s[i+1] >= 0x80 && s[i+1] <= 0x9f {
+			return true
+		}
+	}
+	return false
+}
+
+func logfmtUnsafe(b byte) bool {
+	return b <= ' ' || b == '=' || b == '"' || b == 0x7f
+}
@@ -0,0 +1,129 @@
+package log
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type logfmtPair struct {
+	key, value string
+}
+
+// parseLogfmt parses a line of logfmt, quoted values are unquoted in the
+// manner of Go string literals
+func parseLogfmt(line string) ([]logfmtPair, error) {
+	var pairs []logfmtPair
+	line = strings.TrimSuffix(line, "\n")
+	for line != "" {
+		i := strings.IndexByte(line, '=')
+		if i <= 0 {
+			return nil, errors.New("missing key: " + line)
+		}
+		key := line[:i]
+		if strings.ContainsAny(key, " \"") {
+			return nil, errors.New("bad key: " + key)
+		}
+		line = line[i+1:]
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			j := 1
+			for ; j < len(line) && line[j] != '"'; j++ {
+				if line[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(line) {
+				return nil, errors.New("unterminated value: " + line)
+			}
+			v, err := strconv.Unquote(line[:j+1])
+			if err != nil {
+				return nil, err
+			}
+			value, line = v, line[j+1:]
+		} else {
+			j := strings.IndexByte(line, ' ')
+			if j < 0 {
+				j = len(line)
+			}
+			value, line = line[:j], line[j:]
+		}
+		pairs = append(pairs, logfmtPair{key, value})
+		if line != "" {
+			if line[0] != ' ' {
+				return nil, errors.New("missing space: " + line)
+			}
+			line = line[1:]
+		}
+	}
+	return pairs, nil
+}
+
+func TestLogfmtFormatter(t *testing.T) {
+	ast := assert.New(t)
+	f := NewLogfmtFormatter()
+	rs := testRecords()
+	now := time.Date(2016, 1, 2, 3, 4, 5, 60000000, time.UTC)
+	rs[0].now = now
+	ast.Equal("level=INFO ts=2016-01-02T03:04:05.06Z logger=test caller=file.go:12 msg=message\n", string(f.Format(rs[0])))
+
+	rs[1].now = now
+	rs[1].msg = `say "hi" a=b`
+	ast.Equal(`level=FATA ts=2016-01-02T03:04:05.06Z logger="" caller=file.go:1 app_id=app rpc_id=rpc request_id=req `+
+		`msg="say \"hi\" a=b" k=v int=-1 uint8=2 float=1.5e-10 float32=0.1 bool=true err=oops nil=<nil> `+
+		`slice="[1 2]" bytes="[120 121]" stack="main.main\n\t/path/to/main.go:3"`+"\n", string(f.Format(rs[1])))
+
+	rs[0].name = ""
+	rs[0].fields = []Field{{"a key", ""}, {"", "x"}, {"k=", "\x00\x7f"}, {"c1", "a\u0085b"}, {"latin", "é"}}
+	ast.Equal("level=INFO ts=2016-01-02T03:04:05.06Z logger=\"\" caller=file.go:12 msg=message a_key=\"\" _=x k_=\"\\u0000\\u007f\" c1=\"a\\u0085b\" latin=é\n",
+		string(f.Format(rs[0])))
+
+	e, err := NewEncoder("logfmt")
+	ast.NoError(err)
+	ast.IsType(f, e)
+}
+
+func TestLogfmtRoundTrip(t *testing.T) {
+	ast := assert.New(t)
+	f := NewLogfmtFormatter()
+	for _, msg := range []string{
+		"", " ", "plain", "with space", "a=b", `"quoted"`, `back\slash`, `\"`,
+		"line\nbreak\r\n", "tab\there", "\x00\x01\x1f", "unicode 你好 ✓", "\u2028",
+		"trailing ", "= = =", `ends with \`,
+	} {
+		r := testRecords()[1]
+		r.msg = msg
+		r.fields = []Field{{"value", msg}, {"err", errors.New(msg)}, {"n", 1}}
+		line := string(f.Format(r))
+		ast.Equal(1, strings.Count(line, "\n"), "%q", line)
+		pairs, err := parseLogfmt(line)
+		if !ast.NoError(err, "%q", line) {
+			continue
+		}
+		m := make(map[string]string)
+		for _, p := range pairs {
+			m[p.key] = p.value
+		}
+		ast.Equal("FATA", m["level"])
+		ast.Equal("rpc", m["rpc_id"])
+		ast.Equal(msg, m["msg"], "%q", line)
+		ast.Equal(msg, m["value"], "%q", line)
+		ast.Equal(msg, m["err"], "%q", line)
+		ast.Equal("1", m["n"])
+		ast.Equal(r.stack, m["stack"])
+		ts, err := time.Parse(time.RFC3339Nano, m["ts"])
+		ast.NoError(err)
+		ast.True(ts.Equal(r.now))
+	}
+
+	// invalid UTF-8 is replaced
+	r := testRecords()[0]
+	r.msg = "bad \xff"
+	pairs, err := parseLogfmt(string(f.Format(r)))
+	ast.NoError(err)
+	ast.Equal(logfmtPair{"msg", "bad \ufffd"}, pairs[len(pairs)-1])
+}
@@ -1,5 +1,7 @@
 package log
 
+import "context"
+
 // Namer represents a named object
 type Namer interface {
 	Name() string
@@ -60,6 +62,21 @@ type RPCLogger interface {
 	SetRequestID(requestID string)
 }
 
+// ContextLogger represents a logger with APIs logging values carried by
+// context.Context, see NewContext
+type ContextLogger interface {
+	DebugCtx(ctx context.Context, a ...interface{})
+	DebugfCtx(ctx context.Context, f string, a ...interface{})
+	InfoCtx(ctx context.Context, a ...interface{})
+	InfofCtx(ctx context.Context, f string, a ...interface{})
+	WarnCtx(ctx context.Context, a ...interface{})
+	WarnfCtx(ctx context.Context, f string, a ...interface{})
+	ErrorCtx(ctx context.Context, a ...interface{})
+	ErrorfCtx(ctx context.Context, f string, a ...interface{})
+	FatalCtx(ctx context.Context, a ...interface{})
+	FatalfCtx(ctx context.Context, f string, a ...interface{})
+}
+
 // Debugger represents a logger with Debug APIs
 type Debugger interface {
 	Debug(a ...interface{})
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
@@ -37,3 +38,85 @@ func TestMultiHandler(t *testing.T) {
 	_, ok = hdr.(*StreamHandler)
 	ast.True(ok)
 }
+
+// unregister removes loggers created by tests from the registry
+func unregister(names ...string) {
+	registry.Lock()
+	defer registry.Unlock()
+	for _, name := range names {
+		delete(registry.m, name)
+	}
+}
+
+func TestGetLogger(t *testing.T) {
+	ast := assert.New(t)
+	defer unregister("tree", "tree.db", "tree.db.pool")
+	pool := GetLogger("tree.db.pool")
+	db := GetLogger("tree.db")
+	root := GetLogger("tree")
+	ast.True(pool == GetLogger("tree.db.pool"))
+	ast.True(pool.Parent() == db)
+	ast.True(db.Parent() == root)
+	ast.True(root.Parent() == defaultLogger)
+	ast.True(GetLogger("") == defaultLogger)
+	ast.Equal("tree.db.pool", pool.Name())
+
+	ast.Equal(defaultLevel, pool.Level())
+	root.SetLevel(WARN)
+	ast.Equal(WARN, pool.Level())
+	db.SetLevel(DEBUG)
+	ast.Equal(DEBUG, pool.Level())
+	ast.Equal(WARN, root.Level())
+	pool.SetLevel(ERRO)
+	ast.Equal(ERRO, pool.Level())
+
+	names := make([]string, 0)
+	for _, l := range Loggers() {
+		names = append(names, l.Name())
+	}
+	ast.Contains(names, "tree.db")
+}
+
+func TestWithInheritsFromLogger(t *testing.T) {
+	ast := assert.New(t)
+	defer unregister("probe")
+	svc := GetLogger("probe")
+	child := svc.With("k", "v")
+	svc.SetLevel(DEBUG)
+	ast.Equal(DEBUG, child.Level())
+
+	var buf bytes.Buffer
+	h, _ := NewStreamHandler(&buf, "{{fields}} {{}}")
+	h.Colored(false)
+	svc.AddHandler(h)
+	child.Info("from child")
+	ast.Equal("k=v from child\n", buf.String())
+
+	// setting the level on the child does not affect svc
+	child.SetLevel(ERRO)
+	ast.Equal(ERRO, child.Level())
+	ast.Equal(DEBUG, svc.Level())
+}
+
+func TestInheritHandlers(t *testing.T) {
+	ast := assert.New(t)
+	defer unregister("inherit", "inherit.child")
+	var buf bytes.Buffer
+	svc := GetLogger("inherit")
+	h, _ := NewStreamHandler(&buf, "{{name}} {{}}")
+	svc.AddHandler(h)
+	svc.SetLevel(DEBUG)
+
+	child := GetLogger("inherit.child")
+	child.Debug("from child")
+	child.With("k", "v").Debug("with fields")
+	ast.Equal("inherit.child from child\ninherit.child with fields\n", buf.String())
+
+	buf.Reset()
+	var own bytes.Buffer
+	h2, _ := NewStreamHandler(&own, "{{}}")
+	child.AddHandler(h2)
+	child.Info("own handler")
+	ast.Equal("", buf.String())
+	ast.Equal("own handler\n", own.String())
+}
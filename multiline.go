@@ -0,0 +1,82 @@
+package log
+
+import "bytes"
+
+// MultilinePolicy decides how newlines inside a formatted Record are written,
+// e.g. of messages with error chains or stack dumps
+type MultilinePolicy int
+
+const (
+	// MultilineRaw writes newlines as they are, which is the default
+	MultilineRaw MultilinePolicy = iota
+	// MultilineEscape writes "\n" and "\r" as `\n` and `\r`, so every Record
+	// is a single line, backslashes are doubled to keep the escaping
+	// reversible
+	MultilineEscape
+	// MultilineIndent prefixes every continuation line with the marker
+	MultilineIndent
+)
+
+// DefaultMultilineMarker is the marker of MultilineIndent if not set
+const DefaultMultilineMarker = "  | "
+
+// MultilineOptions configures how a handler writes newlines inside a
+// formatted Record, the trailing newline is always kept as is
+//
+// Output of single line Encoders such as JSONFormatter and LogfmtFormatter is
+// left as is, see SingleLineEncoder.
+type MultilineOptions struct {
+	Policy MultilinePolicy
+	// Marker prefixes continuation lines of MultilineIndent,
+	// DefaultMultilineMarker if empty
+	Marker string
+}
+
+// apply rewrites the newlines of the formatted Record buf[start:] according
+// to the options and returns the rewritten buffer
+func (o MultilineOptions) apply(buf []byte, start int) []byte {
+	if o.Policy == MultilineRaw {
+		return buf
+	}
+	end := len(buf)
+	trailing := end > start && buf[end-1] == '\n'
+	if trailing {
+		end--
+	}
+	body := buf[start:end]
+	if o.Policy == MultilineEscape {
+		if bytes.IndexAny(body, "\n\r\\") < 0 {
+			return buf
+		}
+	} else if bytes.IndexByte(body, '\n') < 0 {
+		return buf
+	}
+	marker := o.Marker
+	if marker == "" {
+		marker = DefaultMultilineMarker
+	}
+
+	tmp := getBuffer()
+	defer putBuffer(tmp)
+	*tmp = append(*tmp, body...)
+	buf = buf[:start]
+	for _, b := range *tmp {
+		switch {
+		case o.Policy == MultilineEscape && b == '\n':
+			buf = append(buf, '\\', 'n')
+		case o.Policy == MultilineEscape && b == '\r':
+			buf = append(buf, '\\', 'r')
+		case o.Policy == MultilineEscape && b == '\\':
+			buf = append(buf, '\\', '\\')
+		case b == '\n':
+			buf = append(buf, '\n')
+			buf = append(buf, marker...)
+		default:
+			buf = append(buf, b)
+		}
+	}
+	if trailing {
+		buf = append(buf, '\n')
+	}
+	return buf
+}
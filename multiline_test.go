@@ -0,0 +1,123 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultilineOptions(t *testing.T) {
+	ast := assert.New(t)
+	for _, c := range []struct {
+		opts    MultilineOptions
+		in, out string
+	}{
+		{MultilineOptions{}, "a\nb\n", "a\nb\n"},
+		{MultilineOptions{Policy: MultilineEscape}, "a\nb\r\nc\n", `a\nb\r\nc` + "\n"},
+		{MultilineOptions{Policy: MultilineEscape}, "a\nb", `a\nb`},
+		{MultilineOptions{Policy: MultilineEscape}, "single\n", "single\n"},
+		{MultilineOptions{Policy: MultilineEscape}, "a\\nb\nc\n", `a\\nb\nc` + "\n"},
+		{MultilineOptions{Policy: MultilineEscape}, `C:\dir`, `C:\\dir`},
+		{MultilineOptions{Policy: MultilineIndent}, "a\nb\nc\n", "a\n  | b\n  | c\n"},
+		{MultilineOptions{Policy: MultilineIndent, Marker: "\t"}, "a\n\nb\n", "a\n\t\n\tb\n"},
+		{MultilineOptions{Policy: MultilineIndent}, "a\r\n", "a\r\n"},
+	} {
+		ast.Equal(c.out, string(c.opts.apply([]byte(c.in), 0)), "%q", c.in)
+		ast.Equal("prefix\n"+c.out, string(c.opts.apply([]byte("prefix\n"+c.in), len("prefix\n"))), "%q", c.in)
+	}
+}
+
+func TestStreamHandlerMultiline(t *testing.T) {
+	ast := assert.New(t)
+	var buf bytes.Buffer
+	l := NewWithWriter("ml", nil)
+	h, _ := NewStreamHandler(&buf, "{{level}} {{}}")
+	l.AddHandler(h)
+
+	l.Error("failed:\ncaused by: oops")
+	ast.Equal("ERRO failed:\ncaused by: oops\n", buf.String())
+
+	buf.Reset()
+	h.SetMultiline(MultilineOptions{Policy: MultilineEscape})
+	l.Error("failed:\ncaused by: oops")
+	ast.Equal("ERRO failed:\\ncaused by: oops\n", buf.String())
+
+	buf.Reset()
+	h.SetMultiline(MultilineOptions{Policy: MultilineIndent, Marker: "> "})
+	l.Error("failed:\ncaused by: oops")
+	ast.Equal("ERRO failed:\n> caused by: oops\n", buf.String())
+}
+
+func TestMultilineEscapeJSON(t *testing.T) {
+	ast := assert.New(t)
+	var buf bytes.Buffer
+	h := NewJSONStreamHandler(&buf)
+	h.SetMultiline(MultilineOptions{Policy: MultilineEscape})
+	h.Log(&Record{msg: "say \"hi\"\nC:\\dir"})
+
+	var v map[string]interface{}
+	ast.NoError(json.Unmarshal(buf.Bytes(), &v))
+	ast.Equal("say \"hi\"\nC:\\dir", v["message"])
+}
+
+// singleLineEncoder writes the message as is, claiming it's a single line
+type singleLineEncoder bool
+
+func (e singleLineEncoder) SingleLine() bool {
+	return bool(e)
+}
+
+func (e singleLineEncoder) AppendFormat(dst []byte, r *Record) []byte {
+	dst = append(dst, r.msg...)
+	return append(dst, '\n')
+}
+
+func TestSingleLineEncoder(t *testing.T) {
+	ast := assert.New(t)
+	var buf bytes.Buffer
+	h, _ := NewStreamHandler(&buf, "{{}}")
+	h.SetMultiline(MultilineOptions{Policy: MultilineEscape})
+
+	h.SetEncoder(singleLineEncoder(true))
+	h.Log(&Record{msg: `C:\dir`})
+	ast.Equal("C:\\dir\n", buf.String())
+
+	buf.Reset()
+	h.SetEncoder(singleLineEncoder(false))
+	h.Log(&Record{msg: `C:\dir`})
+	ast.Equal("C:\\\\dir\n", buf.String())
+}
+
+func TestRemoteSyslogMultiline(t *testing.T) {
+	ast := assert.New(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	h, err := NewRemoteSyslogHandler(RemoteSyslogOptions{
+		Network:  "udp",
+		Addr:     pc.LocalAddr().String(),
+		Hostname: "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	h.SetMultiline(MultilineOptions{Policy: MultilineEscape})
+	r := testSyslogRecord()
+	r.msg = "line 1\nline 2"
+	h.Log(r)
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	ast.NoError(err)
+	ast.True(strings.HasSuffix(string(buf[:n]), `] line 1\nline 2`), "%q", buf[:n])
+}
@@ -3,6 +3,9 @@ package log
 import "time"
 
 // Record stands for a single record of log, usually a single line
+//
+// A Record must not be modified once created, the accessors are provided for
+// handlers outside this package.
 type Record struct {
 	fileLine  string
 	name      string
@@ -12,9 +15,60 @@ type Record struct {
 	rpcID     string
 	requestID string
 	appID     string
+	fields    []Field
+	stack     string
+	tpl       string
 }
 
 // String returns the raw message of the Record
 func (r *Record) String() string {
 	return r.msg
 }
+
+// Message returns the raw message of the Record, same as String
+func (r *Record) Message() string {
+	return r.msg
+}
+
+// Level returns the level of the Record
+func (r *Record) Level() LevelType {
+	return r.lv
+}
+
+// Time returns the time when the Record was created
+func (r *Record) Time() time.Time {
+	return r.now
+}
+
+// Name returns the name of the logger which created the Record
+func (r *Record) Name() string {
+	return r.name
+}
+
+// Caller returns the full path and line number of the caller in format
+// "/path/to/file.go:12"
+func (r *Record) Caller() string {
+	return r.fileLine
+}
+
+// RPCID returns the RPC ID of the Record
+func (r *Record) RPCID() string {
+	return r.rpcID
+}
+
+// RequestID returns the request ID of the Record
+func (r *Record) RequestID() string {
+	return r.requestID
+}
+
+// AppID returns the app ID of the Record
+func (r *Record) AppID() string {
+	return r.appID
+}
+
+// Fields returns a copy of the fields of the Record
+func (r *Record) Fields() []Field {
+	fs := make([]Field, len(r.fields))
+	copy(fs, r.fields)
+	return fs
+}
@@ -0,0 +1,159 @@
+package log
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// PanicAction decides what to do after a panic is logged
+type PanicAction int
+
+const (
+	// PanicSwallow stops the panic
+	PanicSwallow PanicAction = iota
+	// PanicRepanic panics again with the same value
+	PanicRepanic
+	// PanicExit calls os.Exit(1)
+	PanicExit
+)
+
+// PanicOptions decides how a recovered panic is logged and handled
+type PanicOptions struct {
+	// Level of the Record, ERRO if not set
+	Level  LevelType
+	Action PanicAction
+}
+
+// Recover logs a recovered panic with its stack at ERRO level and stops it,
+// it must be deferred directly:
+//
+//	defer l.Recover()
+func (l *Logger) Recover() {
+	if v := recover(); v != nil {
+		l.logPanic(v, PanicOptions{})
+	}
+}
+
+// LogPanic is like Recover but handles the panic as given options, it must
+// be deferred directly:
+//
+//	defer l.LogPanic(log.PanicOptions{Level: log.FATA, Action: log.PanicExit})
+func (l *Logger) LogPanic(opts PanicOptions) {
+	if v := recover(); v != nil {
+		l.logPanic(v, opts)
+	}
+}
+
+// RecoverHandler returns an http.Handler which calls next and handles panics
+// as given options, "Internal Server Error" is replied if the response is not
+// written yet
+//
+// http.ErrAbortHandler is passed through without logging.
+func (l *Logger) RecoverHandler(next http.Handler, opts PanicOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rw := &recoverWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			if !rw.written {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+			l.With("method", req.Method, "url", req.URL.String()).logPanic(v, opts)
+		}()
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// recoverWriter records whether the response is written
+type recoverWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *recoverWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recoverWriter) Write(p []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher if the underlying ResponseWriter does
+func (w *recoverWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.written = true
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the underlying ResponseWriter does
+func (w *recoverWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("log: ResponseWriter does not implement http.Hijacker")
+	}
+	w.written = true
+	return h.Hijack()
+}
+
+// logPanic logs v with the stack of the panicking goroutine, flushes async
+// records, then takes the action of opts, it must be called by the deferred
+// function which recovered v
+func (l *Logger) logPanic(v interface{}, opts PanicOptions) {
+	lv := opts.Level
+	if lv == NOTSET {
+		lv = ERRO
+	}
+	if lv >= l.Level() {
+		skip := panicSkip()
+		r := l.newRecord(skip+1, lv, fmt.Sprintf("panic: %v", v), nil)
+		l.RLock()
+		stack := l.stack
+		l.RUnlock()
+		r.stack = captureStack(skip, stack)
+		l.dispatch(r)
+		l.Flush()
+	}
+
+	switch opts.Action {
+	case PanicRepanic:
+		panic(v)
+	case PanicExit:
+		os.Exit(1)
+	}
+}
+
+// panicSkip returns the skip for runtime.Caller in the caller of panicSkip,
+// which points to the frame where the panic happened
+func panicSkip() int {
+	pcs := make([]uintptr, 64)
+	// skip runtime.Callers and panicSkip
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	inPanic := false
+	for i := 0; ; i++ {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			inPanic = true
+		} else if inPanic && !strings.HasPrefix(frame.Function, "runtime.") {
+			return i
+		}
+		if !more {
+			// not in a panic, the caller of the caller
+			return 1
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package log
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+var registry = struct {
+	sync.Mutex
+	m map[string]*Logger
+}{
+	m: map[string]*Logger{"": defaultLogger},
+}
+
+// GetLogger returns the logger with given name from the registry, it's
+// created along with its ancestors if not exists
+//
+// Dotted names form a tree, e.g. "svc.db.pool" is a child of "svc.db" which
+// is a child of "svc", the root is the default logger with empty name. A
+// logger without its own level or handlers uses the ones of the nearest
+// ancestor which has them, see Logger.Level.
+func GetLogger(name string) *Logger {
+	registry.Lock()
+	defer registry.Unlock()
+	return getLogger(name)
+}
+
+func getLogger(name string) *Logger {
+	if l, ok := registry.m[name]; ok {
+		return l
+	}
+	parentName := ""
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		parentName = name[:i]
+	}
+	l := NewWithWriter(name, nil)
+	l.parent = getLogger(parentName)
+	registry.m[name] = l
+	return l
+}
+
+// Loggers returns all loggers in the registry sorted by name
+func Loggers() []*Logger {
+	registry.Lock()
+	defer registry.Unlock()
+	names := make([]string, 0, len(registry.m))
+	for name := range registry.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ls := make([]*Logger, len(names))
+	for i, name := range names {
+		ls[i] = registry.m[name]
+	}
+	return ls
+}
+
+// Parent returns the parent of logger in the registry, or the logger With was
+// called on for a child created by With, nil for the root and other loggers
+// not created by GetLogger
+func (l *Logger) Parent() *Logger {
+	return l.parent
+}
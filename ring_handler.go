@@ -0,0 +1,164 @@
+package log
+
+import (
+	"container/list"
+	"io"
+	"sync"
+)
+
+const defaultRingMaxRequests = 1024
+
+// RingOptions describes how a RingHandler buffers Records
+type RingOptions struct {
+	// Size is the number of Records kept in a ring
+	Size int
+	// Passthrough is the level at or above which Records are passed to the
+	// wrapped Handler immediately instead of being buffered, INFO if not set
+	Passthrough LevelType
+	// Trigger is the level at or above which buffered Records are flushed to
+	// the wrapped Handler before the triggering one, ERRO if not set
+	Trigger LevelType
+	// PerRequest keeps a ring for each request ID, Records without request
+	// ID share a ring
+	PerRequest bool
+	// MaxRequests is the number of rings kept with PerRequest, the least
+	// recently used ring is dropped when exceeded, 1024 if not set
+	MaxRequests int
+}
+
+type ring struct {
+	key     string
+	records []*Record
+	next    int
+	full    bool
+}
+
+func (rg *ring) add(r *Record) {
+	rg.records[rg.next] = r
+	rg.next++
+	if rg.next == len(rg.records) {
+		rg.next = 0
+		rg.full = true
+	}
+}
+
+// take returns buffered Records from the oldest to the newest and empties
+// the ring
+func (rg *ring) take() []*Record {
+	var rs []*Record
+	if rg.full {
+		rs = append(rs, rg.records[rg.next:]...)
+	}
+	rs = append(rs, rg.records[:rg.next]...)
+	for i := range rg.records {
+		rg.records[i] = nil
+	}
+	rg.next = 0
+	rg.full = false
+	return rs
+}
+
+// RingHandler is a Handler which keeps the recent Records below a level in
+// memory and passes them to the wrapped Handler only when a Record at or
+// above the trigger level arrives, e.g. to see the DEBUG Records preceding
+// an error while logging at INFO
+//
+// The level of the logger must be low enough for Records to reach the
+// RingHandler, e.g. DEBUG. Records not accepted by the wrapped Handler, e.g.
+// below its level, are neither buffered nor passed.
+type RingHandler struct {
+	h    Handler
+	opts RingOptions
+	// mu is held while passing Records to the wrapped Handler, so that
+	// flushed Records are not interleaved with others
+	mu    sync.Mutex
+	rings map[string]*list.Element
+	// order holds the rings from the least to the most recently used
+	order *list.List
+}
+
+// NewRingHandler creates a RingHandler which wraps h
+func NewRingHandler(h Handler, opts RingOptions) *RingHandler {
+	if opts.Size <= 0 {
+		opts.Size = 1
+	}
+	if opts.Passthrough == NOTSET {
+		opts.Passthrough = INFO
+	}
+	if opts.Trigger == NOTSET {
+		opts.Trigger = ERRO
+	}
+	if opts.MaxRequests <= 0 {
+		opts.MaxRequests = defaultRingMaxRequests
+	}
+	return &RingHandler{
+		h:     h,
+		opts:  opts,
+		rings: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Log buffers the Record or passes it to the wrapped Handler, along with
+// the buffered Records if it triggers a flush
+func (rh *RingHandler) Log(r *Record) {
+	key := ""
+	if rh.opts.PerRequest {
+		key = r.requestID
+	}
+
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	if r.lv < rh.opts.Passthrough {
+		rh.ring(key).add(r)
+		return
+	}
+
+	if r.lv >= rh.opts.Trigger {
+		if e, ok := rh.rings[key]; ok {
+			rg := rh.order.Remove(e).(*ring)
+			delete(rh.rings, key)
+			for _, buffered := range rg.take() {
+				rh.h.Log(buffered)
+			}
+		}
+	}
+	rh.h.Log(r)
+}
+
+// ring returns the ring of key, the least recently used ring is dropped if
+// there are too many, rh.mu must be held
+func (rh *RingHandler) ring(key string) *ring {
+	if e, ok := rh.rings[key]; ok {
+		rh.order.MoveToBack(e)
+		return e.Value.(*ring)
+	}
+	if len(rh.rings) >= rh.opts.MaxRequests {
+		oldest := rh.order.Remove(rh.order.Front()).(*ring)
+		delete(rh.rings, oldest.key)
+	}
+	rg := &ring{key: key, records: make([]*Record, rh.opts.Size)}
+	rh.rings[key] = rh.order.PushBack(rg)
+	return rg
+}
+
+// Writer returns the writer of the wrapped Handler
+func (rh *RingHandler) Writer() io.Writer {
+	return rh.h.Writer()
+}
+
+// Accept returns true if the wrapped Handler accepts the Record
+func (rh *RingHandler) Accept(r *Record) bool {
+	if fh, ok := rh.h.(FilteredHandler); ok {
+		return fh.Accept(r)
+	}
+	return true
+}
+
+// Close closes the wrapped Handler if it implements io.Closer
+func (rh *RingHandler) Close() error {
+	if c, ok := rh.h.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
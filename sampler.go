@@ -0,0 +1,215 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// SamplingOptions describes how repetitive Records are sampled
+//
+// Records are counted by their level, format string (or message if not
+// logged by the *f APIs) and caller. In every Interval, the First Records of
+// the same key are handled, then every Thereafter-th of the rest, others are
+// suppressed. A "suppressed N similar messages" Record is logged at the end
+// of an interval in which any Record is suppressed.
+type SamplingOptions struct {
+	Interval   time.Duration
+	First      int
+	Thereafter int
+}
+
+type samplingKey struct {
+	lv       LevelType
+	tpl      string
+	fileLine string
+}
+
+type samplingCounter struct {
+	start      time.Time
+	n          int
+	suppressed int
+	last       *Record
+	timer      stopper
+	gen        int
+}
+
+// stopper is a timer which can be stopped, e.g. *time.Timer
+type stopper interface {
+	Stop() bool
+}
+
+func afterFunc(d time.Duration, f func()) stopper {
+	return time.AfterFunc(d, f)
+}
+
+// sampler counts Records by samplingKey, emit is called with summaries of
+// suppressed Records
+type sampler struct {
+	opts      SamplingOptions
+	emit      func(r *Record)
+	mu        sync.Mutex
+	counters  map[samplingKey]*samplingCounter
+	lastPrune time.Time
+	now       func() time.Time
+	afterFunc func(d time.Duration, f func()) stopper
+}
+
+func newSampler(opts SamplingOptions, emit func(r *Record)) *sampler {
+	return &sampler{
+		opts:      opts,
+		emit:      emit,
+		counters:  make(map[samplingKey]*samplingCounter),
+		now:       time.Now,
+		afterFunc: afterFunc,
+	}
+}
+
+// Allow returns true if the Record should be handled
+func (s *sampler) Allow(r *Record) bool {
+	key := samplingKey{lv: r.lv, tpl: r.tpl, fileLine: r.fileLine}
+	if key.tpl == "" {
+		key.tpl = r.msg
+	}
+	now := s.now()
+
+	s.mu.Lock()
+	s.prune(now)
+	c, ok := s.counters[key]
+	var summary *Record
+	if !ok {
+		c = &samplingCounter{start: now}
+		s.counters[key] = c
+	} else if now.Sub(c.start) >= s.opts.Interval {
+		summary = c.rollover(now)
+		c.start = now
+	}
+	c.n++
+	allow := c.n <= s.opts.First ||
+		(s.opts.Thereafter > 0 && (c.n-s.opts.First)%s.opts.Thereafter == 0)
+	if !allow {
+		c.suppressed++
+		c.last = r
+		if c.timer == nil {
+			gen := c.gen
+			c.timer = s.afterFunc(c.start.Add(s.opts.Interval).Sub(now), func() {
+				s.report(c, gen)
+			})
+		}
+	}
+	s.mu.Unlock()
+
+	if summary != nil {
+		s.emit(summary)
+	}
+	return allow
+}
+
+// report emits the summary of c if it's still in interval gen
+func (s *sampler) report(c *samplingCounter, gen int) {
+	s.mu.Lock()
+	if c.gen != gen {
+		s.mu.Unlock()
+		return
+	}
+	summary := c.rollover(s.now())
+	s.mu.Unlock()
+
+	if summary != nil {
+		s.emit(summary)
+	}
+}
+
+// prune removes idle counters once per interval, s.mu must be held
+func (s *sampler) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < s.opts.Interval {
+		return
+	}
+	s.lastPrune = now
+	for key, c := range s.counters {
+		if c.timer == nil && now.Sub(c.start) >= s.opts.Interval {
+			delete(s.counters, key)
+		}
+	}
+}
+
+// rollover starts a new interval and returns the summary of suppressed
+// Records of the last one if any, which is created at now
+func (c *samplingCounter) rollover(now time.Time) *Record {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	var summary *Record
+	if c.suppressed > 0 {
+		r := *c.last
+		r.now = now
+		r.msg = fmt.Sprintf("suppressed %d similar messages", c.suppressed)
+		r.tpl = ""
+		r.stack = ""
+		summary = &r
+	}
+	c.gen++
+	c.n = 0
+	c.suppressed = 0
+	c.last = nil
+	return summary
+}
+
+// SetSampling samples Records of logger with given options, a zero Interval
+// disables sampling
+//
+// Child loggers created by With share the counters of logger.
+func (l *Logger) SetSampling(opts SamplingOptions) {
+	l.Lock()
+	defer l.Unlock()
+	if opts.Interval <= 0 {
+		l.sampler = nil
+		return
+	}
+	l.sampler = newSampler(opts, l.dispatch)
+}
+
+// SampledHandler is a Handler which samples Records before passing them to
+// the wrapped Handler, see SamplingOptions
+type SampledHandler struct {
+	h       Handler
+	sampler *sampler
+}
+
+// NewSampledHandler creates a SampledHandler which wraps h
+func NewSampledHandler(h Handler, opts SamplingOptions) *SampledHandler {
+	return &SampledHandler{
+		h:       h,
+		sampler: newSampler(opts, h.Log),
+	}
+}
+
+// Log passes the Record to the wrapped Handler unless it's suppressed
+func (sh *SampledHandler) Log(r *Record) {
+	if sh.sampler.Allow(r) {
+		sh.h.Log(r)
+	}
+}
+
+// Writer returns the writer of the wrapped Handler
+func (sh *SampledHandler) Writer() io.Writer {
+	return sh.h.Writer()
+}
+
+// Accept returns true if the wrapped Handler accepts the Record
+func (sh *SampledHandler) Accept(r *Record) bool {
+	if fh, ok := sh.h.(FilteredHandler); ok {
+		return fh.Accept(r)
+	}
+	return true
+}
+
+// Close closes the wrapped Handler if it implements io.Closer
+func (sh *SampledHandler) Close() error {
+	if c, ok := sh.h.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var pid = os.Getpid()
+
+// segment appends a part of a formatted Record to dst, segments of
+// placeholders are named after them and painted if the Formatter is colored
+type segment struct {
+	name   string
+	append func(dst []byte, r *Record) []byte
+}
+
+// placeholders maps placeholder names to their appenders, each of them
+// produces the same output as the template function of the same name
+var placeholders = map[string]func(dst []byte, r *Record) []byte{
+	"level":      appendLevel,
+	"l":          appendL,
+	"name":       appendName,
+	"pid":        appendPid,
+	"file_line":  appendFileLine,
+	"rpc_id":     appendRPCID,
+	"request_id": appendRequestID,
+	"app_id":     appendAppID,
+	"fields":     appendFields,
+	"stack":      appendStack,
+}
+
+// timePlaceholders are the placeholders of time, which is converted to the
+// location of Formatter
+var timePlaceholders = map[string]func(f *Formatter, dst []byte, t time.Time) []byte{
+	"date":        appendDate,
+	"time":        appendTime,
+	"datetime":    appendDatetime,
+	"iso8601":     appendISO8601,
+	"rfc3339nano": appendRFC3339Nano,
+	"unix":        appendUnix,
+	"unix_ms":     appendUnixMs,
+	"unix_ns":     appendUnixNs,
+}
+
+// compile compiles a format string into segments, false is returned if the
+// format contains anything other than plain text and known placeholders, in
+// which case the format is left to text/template
+func (f *Formatter) compile(format string) ([]segment, bool) {
+	var segs []segment
+	for format != "" {
+		i := strings.Index(format, "{{")
+		if i < 0 {
+			segs = append(segs, textSegment(format))
+			break
+		}
+		if i > 0 {
+			segs = append(segs, textSegment(format[:i]))
+		}
+		format = format[i+2:]
+		j := strings.Index(format, "}}")
+		if j < 0 {
+			return nil, false
+		}
+		seg, ok := f.actionSegment(strings.TrimSpace(format[:j]))
+		if !ok {
+			return nil, false
+		}
+		segs = append(segs, seg)
+		format = format[j+2:]
+	}
+	return segs, true
+}
+
+func textSegment(text string) segment {
+	return segment{append: func(dst []byte, r *Record) []byte {
+		return append(dst, text...)
+	}}
+}
+
+func (f *Formatter) actionSegment(action string) (segment, bool) {
+	if action == "" || action == ".String" {
+		return segment{name: "message", append: appendMessage}, true
+	}
+	if fn, ok := placeholders[action]; ok {
+		return segment{name: action, append: fn}, true
+	}
+	if fn, ok := timePlaceholders[action]; ok {
+		return segment{name: action, append: func(dst []byte, r *Record) []byte {
+			return fn(f, dst, f.timeOf(r))
+		}}, true
+	}
+	if strings.HasPrefix(action, "time ") {
+		layout, err := strconv.Unquote(strings.TrimSpace(action[len("time "):]))
+		if err != nil {
+			return segment{}, false
+		}
+		return segment{name: "time", append: func(dst []byte, r *Record) []byte {
+			return f.timeOf(r).AppendFormat(dst, layout)
+		}}, true
+	}
+	if strings.HasPrefix(action, "field ") {
+		key, err := strconv.Unquote(strings.TrimSpace(action[len("field "):]))
+		if err != nil {
+			return segment{}, false
+		}
+		return segment{name: "field", append: func(dst []byte, r *Record) []byte {
+			return appendField(dst, r, key)
+		}}, true
+	}
+	return segment{}, false
+}
+
+func appendMessage(dst []byte, r *Record) []byte {
+	return append(dst, r.msg...)
+}
+
+func appendLevel(dst []byte, r *Record) []byte {
+	return append(dst, LevelName[r.lv]...)
+}
+
+func appendL(dst []byte, r *Record) []byte {
+	return append(dst, LevelName[r.lv][0:1]...)
+}
+
+func appendDate(f *Formatter, dst []byte, t time.Time) []byte {
+	return t.AppendFormat(dst, "2006-01-02")
+}
+
+func appendTime(f *Formatter, dst []byte, t time.Time) []byte {
+	return t.AppendFormat(dst, f.layouts.time)
+}
+
+func appendDatetime(f *Formatter, dst []byte, t time.Time) []byte {
+	return t.AppendFormat(dst, f.layouts.datetime)
+}
+
+func appendISO8601(f *Formatter, dst []byte, t time.Time) []byte {
+	return t.AppendFormat(dst, f.layouts.iso8601)
+}
+
+func appendRFC3339Nano(f *Formatter, dst []byte, t time.Time) []byte {
+	return t.AppendFormat(dst, time.RFC3339Nano)
+}
+
+func appendUnix(f *Formatter, dst []byte, t time.Time) []byte {
+	return strconv.AppendInt(dst, t.Unix(), 10)
+}
+
+func appendUnixMs(f *Formatter, dst []byte, t time.Time) []byte {
+	return strconv.AppendInt(dst, t.UnixNano()/1e6, 10)
+}
+
+func appendUnixNs(f *Formatter, dst []byte, t time.Time) []byte {
+	return strconv.AppendInt(dst, t.UnixNano(), 10)
+}
+
+func appendName(dst []byte, r *Record) []byte {
+	return append(dst, r.name...)
+}
+
+func appendPid(dst []byte, r *Record) []byte {
+	return strconv.AppendInt(dst, int64(pid), 10)
+}
+
+func appendFileLine(dst []byte, r *Record) []byte {
+	return append(dst, shortFileLine(r.fileLine)...)
+}
+
+func appendOrDash(dst []byte, s string) []byte {
+	if s == "" {
+		return append(dst, '-')
+	}
+	return append(dst, s...)
+}
+
+func appendRPCID(dst []byte, r *Record) []byte {
+	return appendOrDash(dst, r.rpcID)
+}
+
+func appendRequestID(dst []byte, r *Record) []byte {
+	return appendOrDash(dst, r.requestID)
+}
+
+func appendAppID(dst []byte, r *Record) []byte {
+	return appendOrDash(dst, r.appID)
+}
+
+func appendFields(dst []byte, r *Record) []byte {
+	if len(r.fields) == 0 {
+		return append(dst, '-')
+	}
+	for i, field := range r.fields {
+		if i > 0 {
+			dst = append(dst, ' ')
+		}
+		dst = append(dst, field.Key...)
+		dst = append(dst, '=')
+		dst = appendValue(dst, field.Value)
+	}
+	return dst
+}
+
+func appendField(dst []byte, r *Record, key string) []byte {
+	for _, field := range r.fields {
+		if field.Key == key {
+			return appendValue(dst, field.Value)
+		}
+	}
+	return append(dst, '-')
+}
+
+func appendStack(dst []byte, r *Record) []byte {
+	return append(dst, r.stack...)
+}
+
+// appendValue appends v in the manner of fmt.Sprint, common types are
+// appended without allocation
+func appendValue(dst []byte, v interface{}) []byte {
+	switch vv := v.(type) {
+	case string:
+		return append(dst, vv...)
+	case int:
+		return strconv.AppendInt(dst, int64(vv), 10)
+	case int8:
+		return strconv.AppendInt(dst, int64(vv), 10)
+	case int16:
+		return strconv.AppendInt(dst, int64(vv), 10)
+	case int32:
+		return strconv.AppendInt(dst, int64(vv), 10)
+	case int64:
+		return strconv.AppendInt(dst, vv, 10)
+	case uint:
+		return strconv.AppendUint(dst, uint64(vv), 10)
+	case uint8:
+		return strconv.AppendUint(dst, uint64(vv), 10)
+	case uint16:
+		return strconv.AppendUint(dst, uint64(vv), 10)
+	case uint32:
+		return strconv.AppendUint(dst, uint64(vv), 10)
+	case uint64:
+		return strconv.AppendUint(dst, vv, 10)
+	case bool:
+		return strconv.AppendBool(dst, vv)
+	case float32:
+		return strconv.AppendFloat(dst, float64(vv), 'g', -1, 32)
+	case float64:
+		return strconv.AppendFloat(dst, vv, 'g', -1, 64)
+	}
+	return append(dst, fmt.Sprint(v)...)
+}
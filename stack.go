@@ -0,0 +1,79 @@
+package log
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const defaultStackDepth = 32
+
+// StackOptions decides when and how a stack trace is captured for a Record
+type StackOptions struct {
+	// Level at or above which stack traces are captured, NOTSET disables
+	// capturing
+	Level LevelType
+	// Depth is the maximum number of frames, 32 if not set
+	Depth int
+	// TrimPrefixes are trimmed from function names and file paths, e.g.
+	// "github.com/eleme/" or GOPATH
+	TrimPrefixes []string
+}
+
+// captureStack returns the stack of the caller, skip is the number of frames
+// to skip as in runtime.Caller
+//
+// Each frame is formatted in two lines as in runtime/debug.Stack:
+//
+//	github.com/eleme/log.(*Logger).Error
+//		/path/to/log.go:12
+func captureStack(skip int, opts StackOptions) string {
+	depth := opts.Depth
+	if depth <= 0 {
+		depth = defaultStackDepth
+	}
+	pcs := make([]uintptr, depth)
+	// runtime.Callers counts itself and captureStack
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var buf []byte
+	for {
+		frame, more := frames.Next()
+		if len(buf) > 0 {
+			buf = append(buf, '\n')
+		}
+		buf = append(buf, trimPrefixes(frame.Function, opts.TrimPrefixes)...)
+		buf = append(buf, "\n\t"...)
+		buf = append(buf, trimPrefixes(frame.File, opts.TrimPrefixes)...)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(frame.Line), 10)
+		if !more {
+			break
+		}
+	}
+	return string(buf)
+}
+
+func trimPrefixes(s string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return s[len(prefix):]
+		}
+	}
+	return s
+}
+
+// SetStackTrace sets when and how stack traces are captured for Records of
+// logger, see StackOptions
+func (l *Logger) SetStackTrace(opts StackOptions) {
+	l.Lock()
+	defer l.Unlock()
+	l.stack = opts
+}
+
+// Stack returns the stack trace captured for the Record, empty if not
+// captured, see Logger.SetStackTrace
+func (r *Record) Stack() string {
+	return r.stack
+}
@@ -1,11 +1,16 @@
 package log
 
-import "log/syslog"
+import (
+	"io"
+	"log/syslog"
+)
 
 // SyslogHandler can send log to syslog
 type SyslogHandler struct {
-	*Formatter
-	w *syslog.Writer
+	handlerEncoder
+	multiline MultilineOptions
+	w         *syslog.Writer
+	HandlerFilter
 }
 
 // NewSyslogHandler creates a SyslogHandler with given syslog.Writer which
@@ -22,13 +27,28 @@ func NewSyslogHandlerWithFormat(w *syslog.Writer, f string) (*SyslogHandler, err
 	h := new(SyslogHandler)
 	h.w = w
 	formatter, err := NewFormatter(f, false)
-	h.Formatter = formatter
+	h.SetEncoder(formatter)
 	return h, err
 }
 
+// NewJSONSyslogHandler creates a SyslogHandler with given syslog.Writer which
+// sends Records as JSON, see JSONFormatter
+func NewJSONSyslogHandler(w *syslog.Writer) *SyslogHandler {
+	h := new(SyslogHandler)
+	h.w = w
+	h.SetEncoder(NewJSONFormatter())
+	return h
+}
+
+// SetMultiline sets how newlines inside a formatted Record are written, raw
+// by default
+func (sh *SyslogHandler) SetMultiline(opts MultilineOptions) {
+	sh.multiline = opts
+}
+
 // Log prints the Record info syslog writer
 func (sh *SyslogHandler) Log(r *Record) {
-	b := string(sh.Formatter.Format(r))
+	b := string(sh.appendEncoded(nil, r, sh.multiline))
 	switch r.lv {
 	case DEBUG:
 		sh.w.Debug(b)
@@ -42,3 +62,13 @@ func (sh *SyslogHandler) Log(r *Record) {
 		sh.w.Crit(b)
 	}
 }
+
+// Writer returns the syslog writer
+func (sh *SyslogHandler) Writer() io.Writer {
+	return sh.w
+}
+
+// Close closes the syslog writer
+func (sh *SyslogHandler) Close() error {
+	return sh.w.Close()
+}
@@ -0,0 +1,411 @@
+package log
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SyslogFormat is the message format of RemoteSyslogHandler
+type SyslogFormat int
+
+const (
+	// RFC5424 is the current syslog protocol with structured data
+	RFC5424 SyslogFormat = iota
+	// RFC3164 is the legacy BSD syslog format
+	RFC3164
+)
+
+// SyslogFraming is the framing of messages over stream transports
+type SyslogFraming int
+
+const (
+	// NonTransparentFraming terminates each message with a newline
+	NonTransparentFraming SyslogFraming = iota
+	// OctetCountingFraming prefixes each message with its length, RFC 6587
+	OctetCountingFraming
+)
+
+// Facility is the syslog facility
+type Facility int
+
+// Syslog facilities
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLpr
+	FacilityNews
+	FacilityUucp
+	FacilityCron
+	FacilityAuthpriv
+	FacilityFtp
+	_
+	_
+	_
+	_
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+const (
+	defaultSyslogSDID       = "meta@32473"
+	defaultSyslogMaxBackoff = 30 * time.Second
+	defaultSyslogTimeout    = 5 * time.Second
+	minSyslogBackoff        = 100 * time.Millisecond
+)
+
+var (
+	errSyslogBackoff = errors.New("log: syslog reconnecting")
+	errSyslogClosed  = errors.New("log: syslog handler is closed")
+)
+
+// severities maps levels to syslog severities
+var severities = map[LevelType]int{
+	DEBUG: 7,
+	INFO:  6,
+	WARN:  4,
+	ERRO:  3,
+	FATA:  2,
+}
+
+// RemoteSyslogOptions describes how RemoteSyslogHandler talks to the server
+type RemoteSyslogOptions struct {
+	// Network is one of "udp", "tcp", "tls", "unix" and "unixgram"
+	Network string
+	// Addr is the address of the server, or the path of the unix socket
+	Addr string
+	// TLSConfig is used by "tls" network
+	TLSConfig *tls.Config
+	// DialTimeout is the timeout of connecting, no timeout if not set
+	DialTimeout time.Duration
+	// WriteTimeout is the timeout of sending a message, 5s if not set, the
+	// connection is closed and dialed again on timeout
+	WriteTimeout time.Duration
+
+	Format  SyslogFormat
+	Framing SyslogFraming
+
+	// Facility of all Records, unless FacilityFunc is set
+	Facility Facility
+	// FacilityFunc returns the facility of each Record
+	FacilityFunc func(r *Record) Facility
+
+	// Hostname is os.Hostname() if not set
+	Hostname string
+	// AppName (TAG in RFC 3164) is the base name of os.Args[0] if not set
+	AppName string
+	// SDID is the ID of the structured data element carrying app_id, rpc_id
+	// and request_id in RFC 5424, "meta@32473" if not set
+	SDID string
+
+	// MaxBackoff is the longest wait between reconnections, 30s if not set
+	MaxBackoff time.Duration
+}
+
+// RemoteSyslogHandler sends Records to a syslog server without log/syslog,
+// supporting RFC 3164 and RFC 5424 over UDP, TCP, TLS and unix sockets
+//
+// Records are dropped while the connection is lost, a reconnection is tried
+// before sending a Record with a backoff doubling up to MaxBackoff.
+type RemoteSyslogHandler struct {
+	handlerEncoder
+	multiline MultilineOptions
+	HandlerFilter
+
+	opts     RemoteSyslogOptions
+	stream   bool
+	mu       sync.Mutex
+	conn     net.Conn
+	closed   bool
+	backoff  time.Duration
+	nextDial time.Time
+	now      func() time.Time
+}
+
+// NewRemoteSyslogHandler creates a RemoteSyslogHandler and connects to the
+// server, the message format is "{{}}" for RFC 5424 as the IDs are sent in
+// structured data, and syslogTpl for RFC 3164:
+//
+//	"[{{app_id}} {{rpc_id}} {{request_id}}] ## {{}}"
+func NewRemoteSyslogHandler(opts RemoteSyslogOptions) (*RemoteSyslogHandler, error) {
+	f := "{{}}"
+	if opts.Format == RFC3164 {
+		f = syslogTpl
+	}
+	return NewRemoteSyslogHandlerWithFormat(opts, f)
+}
+
+// NewRemoteSyslogHandlerWithFormat is just like NewRemoteSyslogHandler but
+// with customized message format
+func NewRemoteSyslogHandlerWithFormat(opts RemoteSyslogOptions, f string) (*RemoteSyslogHandler, error) {
+	switch opts.Network {
+	case "udp", "udp4", "udp6", "unixgram":
+	case "tcp", "tcp4", "tcp6", "tls", "unix":
+	default:
+		return nil, errors.New("log: unknown syslog network: " + opts.Network)
+	}
+	formatter, err := NewFormatter(f, false)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.AppName == "" {
+		opts.AppName = filepath.Base(os.Args[0])
+	}
+	if opts.SDID == "" {
+		opts.SDID = defaultSyslogSDID
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultSyslogMaxBackoff
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = defaultSyslogTimeout
+	}
+	h := &RemoteSyslogHandler{opts: opts, now: time.Now}
+	h.SetEncoder(formatter)
+	switch opts.Network {
+	case "tcp", "tcp4", "tcp6", "tls", "unix":
+		h.stream = true
+	}
+	if err := h.dial(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// SetMultiline sets how newlines inside a formatted Record are written, raw
+// by default
+//
+// Newlines must not be raw with NonTransparentFraming over stream networks,
+// where they delimit messages.
+func (sh *RemoteSyslogHandler) SetMultiline(opts MultilineOptions) {
+	sh.multiline = opts
+}
+
+// Log sends the Record to the server
+func (sh *RemoteSyslogHandler) Log(r *Record) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	*buf = sh.appendMessage(*buf, r)
+	writerLocks.Lock(sh)
+	defer writerLocks.Unlock(sh)
+	sh.Write(*buf)
+}
+
+// Writer returns the handler itself, which stays the same across
+// reconnections
+func (sh *RemoteSyslogHandler) Writer() io.Writer {
+	return sh
+}
+
+// Write sends p as a whole message, reconnecting if necessary, p must be
+// framed if the transport is a stream
+func (sh *RemoteSyslogHandler) Write(p []byte) (int, error) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.closed {
+		return 0, errSyslogClosed
+	}
+	if sh.conn != nil {
+		n, err := sh.writeLocked(p)
+		if err == nil {
+			return n, nil
+		}
+		sh.conn.Close()
+		sh.conn = nil
+	}
+	if sh.now().Before(sh.nextDial) {
+		return 0, errSyslogBackoff
+	}
+	if err := sh.dialLocked(); err != nil {
+		return 0, err
+	}
+	n, err := sh.writeLocked(p)
+	if err != nil {
+		sh.conn.Close()
+		sh.conn = nil
+	}
+	return n, err
+}
+
+// writeLocked writes p to the connection within WriteTimeout, sh.mu must be
+// held
+func (sh *RemoteSyslogHandler) writeLocked(p []byte) (int, error) {
+	if err := sh.conn.SetWriteDeadline(time.Now().Add(sh.opts.WriteTimeout)); err != nil {
+		return 0, err
+	}
+	return sh.conn.Write(p)
+}
+
+// Close closes the connection, the handler can't be used afterwards
+func (sh *RemoteSyslogHandler) Close() error {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.closed = true
+	if sh.conn == nil {
+		return nil
+	}
+	err := sh.conn.Close()
+	sh.conn = nil
+	return err
+}
+
+func (sh *RemoteSyslogHandler) dial() error {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.dialLocked()
+}
+
+// dialLocked connects to the server, the backoff is doubled on failure and
+// reset on success, sh.mu must be held
+func (sh *RemoteSyslogHandler) dialLocked() error {
+	dialer := &net.Dialer{Timeout: sh.opts.DialTimeout}
+	var conn net.Conn
+	var err error
+	if sh.opts.Network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", sh.opts.Addr, sh.opts.TLSConfig)
+	} else {
+		conn, err = dialer.Dial(sh.opts.Network, sh.opts.Addr)
+	}
+	if err != nil {
+		if sh.backoff == 0 {
+			sh.backoff = minSyslogBackoff
+		} else if sh.backoff *= 2; sh.backoff > sh.opts.MaxBackoff {
+			sh.backoff = sh.opts.MaxBackoff
+		}
+		sh.nextDial = sh.now().Add(sh.backoff)
+		return err
+	}
+	sh.conn = conn
+	sh.backoff = 0
+	return nil
+}
+
+// appendMessage appends the framed syslog message of the Record to dst
+func (sh *RemoteSyslogHandler) appendMessage(dst []byte, r *Record) []byte {
+	if !sh.stream || sh.opts.Framing != OctetCountingFraming {
+		dst = sh.appendSyslog(dst, r)
+		if sh.stream {
+			dst = append(dst, '\n')
+		}
+		return dst
+	}
+	msg := getBuffer()
+	defer putBuffer(msg)
+	*msg = sh.appendSyslog(*msg, r)
+	dst = strconv.AppendInt(dst, int64(len(*msg)), 10)
+	dst = append(dst, ' ')
+	return append(dst, *msg...)
+}
+
+// appendSyslog appends the syslog message of the Record without framing
+func (sh *RemoteSyslogHandler) appendSyslog(dst []byte, r *Record) []byte {
+	facility := sh.opts.Facility
+	if sh.opts.FacilityFunc != nil {
+		facility = sh.opts.FacilityFunc(r)
+	}
+	dst = append(dst, '<')
+	dst = strconv.AppendInt(dst, int64(facility)*8+int64(severities[r.lv]), 10)
+	dst = append(dst, '>')
+
+	if sh.opts.Format == RFC3164 {
+		// Jan  2 15:04:05 host app[123]: msg
+		dst = r.now.AppendFormat(dst, time.Stamp)
+		dst = append(dst, ' ')
+		dst = append(dst, sh.opts.Hostname...)
+		dst = append(dst, ' ')
+		dst = append(dst, sh.opts.AppName...)
+		dst = append(dst, '[')
+		dst = strconv.AppendInt(dst, int64(pid), 10)
+		dst = append(dst, "]: "...)
+	} else {
+		// 1 2006-01-02T15:04:05.000000Z07:00 host app 123 - [sd] msg
+		dst = append(dst, "1 "...)
+		dst = r.now.AppendFormat(dst, "2006-01-02T15:04:05.000000Z07:00")
+		dst = append(dst, ' ')
+		dst = appendSyslogHeader(dst, sh.opts.Hostname, 255)
+		dst = append(dst, ' ')
+		dst = appendSyslogHeader(dst, sh.opts.AppName, 48)
+		dst = append(dst, ' ')
+		dst = strconv.AppendInt(dst, int64(pid), 10)
+		dst = append(dst, " - "...)
+		dst = sh.appendStructuredData(dst, r)
+		dst = append(dst, ' ')
+	}
+
+	n := len(dst)
+	dst = sh.appendEncoded(dst, r, sh.multiline)
+	// the trailing newline added by Formatter is not part of the message
+	for len(dst) > n && dst[len(dst)-1] == '\n' {
+		dst = dst[:len(dst)-1]
+	}
+	return dst
+}
+
+// appendSyslogHeader appends a header field of RFC 5424, which is printable
+// ASCII without space, "-" if empty
+func appendSyslogHeader(dst []byte, s string, max int) []byte {
+	if s == "" {
+		return append(dst, '-')
+	}
+	for i := 0; i < len(s) && i < max; i++ {
+		if c := s[i]; c > ' ' && c < 0x7f {
+			dst = append(dst, c)
+		} else {
+			dst = append(dst, '_')
+		}
+	}
+	return dst
+}
+
+// appendStructuredData appends the IDs of Record as an SD-ELEMENT, "-" if
+// all of them are empty
+func (sh *RemoteSyslogHandler) appendStructuredData(dst []byte, r *Record) []byte {
+	if r.appID == "" && r.rpcID == "" && r.requestID == "" {
+		return append(dst, '-')
+	}
+	dst = append(dst, '[')
+	dst = append(dst, sh.opts.SDID...)
+	dst = appendSDParam(dst, "app_id", r.appID)
+	dst = appendSDParam(dst, "rpc_id", r.rpcID)
+	dst = appendSDParam(dst, "request_id", r.requestID)
+	return append(dst, ']')
+}
+
+// appendSDParam appends ` name="value"` with '"', '\' and ']' escaped, empty
+// values are omitted
+func appendSDParam(dst []byte, name, value string) []byte {
+	if value == "" {
+		return dst
+	}
+	dst = append(dst, ' ')
+	dst = append(dst, name...)
+	dst = append(dst, '=', '"')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\', ']':
+			dst = append(dst, '\\', c)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return append(dst, '"')
+}
@@ -0,0 +1,284 @@
+package log
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSyslogRecord() *Record {
+	return &Record{
+		name:      "test",
+		now:       time.Date(2016, 1, 2, 3, 4, 5, 6000, time.UTC),
+		lv:        WARN,
+		msg:       "hello world",
+		rpcID:     "rpc",
+		requestID: `r"q]`,
+		appID:     "app",
+	}
+}
+
+func TestRemoteSyslogUDP(t *testing.T) {
+	ast := assert.New(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	h, err := NewRemoteSyslogHandler(RemoteSyslogOptions{
+		Network:  "udp",
+		Addr:     pc.LocalAddr().String(),
+		Facility: FacilityLocal0,
+		Hostname: "host",
+		AppName:  "app name",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	h.Log(testSyslogRecord())
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	ast.NoError(err)
+	expected := "<132>1 2016-01-02T03:04:05.000006Z host app_name " + strconv.Itoa(pid) +
+		` - [meta@32473 app_id="app" rpc_id="rpc" request_id="r\"q\]"] hello world`
+	ast.Equal(expected, string(buf[:n]))
+}
+
+func TestRemoteSyslogTCP(t *testing.T) {
+	ast := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	for _, framing := range []SyslogFraming{OctetCountingFraming, NonTransparentFraming} {
+		h, err := NewRemoteSyslogHandler(RemoteSyslogOptions{
+			Network:  "tcp",
+			Addr:     ln.Addr().String(),
+			Format:   RFC3164,
+			Framing:  framing,
+			Hostname: "host",
+			AppName:  "app",
+			FacilityFunc: func(r *Record) Facility {
+				if r.Level() >= ERRO {
+					return FacilityAuth
+				}
+				return FacilityUser
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := testSyslogRecord()
+		h.Log(r)
+		r.lv = ERRO
+		h.Log(r)
+		h.Close()
+
+		b, err := ioutil.ReadAll(conn)
+		conn.Close()
+		ast.NoError(err)
+		msg := "<12>Jan  2 03:04:05 host app[" + strconv.Itoa(pid) + `]: [app rpc r"q]] ## hello world`
+		msg2 := "<35>" + msg[4:]
+		if framing == OctetCountingFraming {
+			ast.Equal(strconv.Itoa(len(msg))+" "+msg+strconv.Itoa(len(msg2))+" "+msg2, string(b))
+		} else {
+			ast.Equal(msg+"\n"+msg2+"\n", string(b))
+		}
+	}
+}
+
+// selfSignedCert generates a certificate of 127.0.0.1 for tests
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "log test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestRemoteSyslogTLS(t *testing.T) {
+	ast := assert.New(t)
+	cert, pool := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		b, err := ioutil.ReadAll(conn)
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		received <- string(b)
+	}()
+
+	h, err := NewRemoteSyslogHandler(RemoteSyslogOptions{
+		Network:     "tls",
+		Addr:        ln.Addr().String(),
+		TLSConfig:   &tls.Config{RootCAs: pool},
+		DialTimeout: time.Second,
+		Framing:     OctetCountingFraming,
+		Facility:    FacilityUser,
+		Hostname:    "host",
+		AppName:     "app",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Log(testSyslogRecord())
+	h.Close()
+
+	msg := "<12>1 2016-01-02T03:04:05.000006Z host app " + strconv.Itoa(pid) +
+		` - [meta@32473 app_id="app" rpc_id="rpc" request_id="r\"q\]"] hello world`
+	select {
+	case b := <-received:
+		ast.Equal(strconv.Itoa(len(msg))+" "+msg, b)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestRemoteSyslogWriteTimeout(t *testing.T) {
+	ast := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	h, err := NewRemoteSyslogHandler(RemoteSyslogOptions{
+		Network:      "tcp",
+		Addr:         ln.Addr().String(),
+		WriteTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// writes to a pipe block until the other end reads, which never happens
+	client, server := net.Pipe()
+	defer server.Close()
+	h.conn.Close()
+	h.conn = client
+
+	// the timed out connection is replaced by a new one
+	_, err = h.Write([]byte("hello"))
+	ast.NoError(err)
+	ast.NotEqual(client, h.conn)
+}
+
+func TestRemoteSyslogReconnect(t *testing.T) {
+	ast := assert.New(t)
+	dir, err := ioutil.TempDir("", "log_syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "syslog.sock")
+
+	ln, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewRemoteSyslogHandlerWithFormat(RemoteSyslogOptions{Network: "unix", Addr: addr}, "{{}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	clock := &fakeClock{now: time.Date(2016, 1, 2, 3, 4, 5, 0, time.Local)}
+	h.now = clock.Now
+	conn, _ := ln.Accept()
+	conn.Close()
+	ln.Close()
+
+	// the first write fails and the reconnection is refused
+	_, err = h.Write([]byte("lost\n"))
+	ast.Error(err)
+	_, err = h.Write([]byte("lost\n"))
+	ast.Equal(errSyslogBackoff, err)
+
+	ln, err = net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, err = h.Write([]byte("lost\n"))
+	ast.Equal(errSyslogBackoff, err)
+	clock.Add(minSyslogBackoff)
+
+	r := testSyslogRecord()
+	r.msg = "back"
+	h.Log(r)
+	conn, err = ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	ast.NoError(err)
+	ast.Contains(line, " - [meta@32473 ")
+	ast.True(len(line) > 5 && line[len(line)-5:] == "back\n", line)
+
+	// no reconnection after Close
+	ast.NoError(h.Close())
+	_, err = h.Write([]byte("closed\n"))
+	ast.Equal(errSyslogClosed, err)
+	ast.Nil(h.conn)
+}
@@ -0,0 +1,120 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openPty opens a pseudo terminal pair
+func openPty(t *testing.T) (*os.File, *os.File) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("pty not available: %v", err)
+	}
+	var unlock int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		master.Close()
+		t.Skipf("unlockpt: %v", errno)
+	}
+	var n uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		master.Close()
+		t.Skipf("ptsname: %v", errno)
+	}
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Skipf("open pts: %v", err)
+	}
+	return master, slave
+}
+
+type fdWriter struct {
+	io.Writer
+	fd uintptr
+}
+
+func (w fdWriter) Fd() uintptr {
+	return w.fd
+}
+
+type wrappedWriter struct {
+	io.Writer
+	w io.Writer
+}
+
+func (w wrappedWriter) Unwrap() io.Writer {
+	return w.w
+}
+
+func TestIsTerminalPty(t *testing.T) {
+	ast := assert.New(t)
+	master, slave := openPty(t)
+	defer master.Close()
+	defer slave.Close()
+
+	ast.True(IsTerminal(slave))
+	ast.True(IsTerminal(master))
+
+	// any writer with a file descriptor
+	ast.True(IsTerminal(fdWriter{&bytes.Buffer{}, slave.Fd()}))
+
+	// wrapped writers
+	buffered := bufio.NewWriter(slave)
+	ast.False(IsTerminal(buffered))
+	ast.True(IsTerminal(wrappedWriter{buffered, slave}))
+	ast.True(IsTerminal(wrappedWriter{buffered, wrappedWriter{buffered, slave}}))
+}
+
+func TestIsTerminalNotTerminal(t *testing.T) {
+	ast := assert.New(t)
+	r, w, err := os.Pipe()
+	ast.NoError(err)
+	defer r.Close()
+	defer w.Close()
+
+	ast.False(IsTerminal(w))
+	ast.False(IsTerminal(&bytes.Buffer{}))
+	ast.False(IsTerminal(wrappedWriter{w, w}))
+	ast.False(IsTerminal(wrappedWriter{w, nil}))
+	ast.False(IsTerminal(nil))
+
+	// cycles are not followed forever
+	cycle := &cyclicWriter{}
+	cycle.w = cycle
+	ast.False(IsTerminal(cycle))
+}
+
+func TestIsTerminalKeepsNonblocking(t *testing.T) {
+	ast := assert.New(t)
+	r, w, err := os.Pipe()
+	ast.NoError(err)
+	defer r.Close()
+	defer w.Close()
+
+	ast.False(IsTerminal(w))
+	rc, err := w.SyscallConn()
+	ast.NoError(err)
+	var flags uintptr
+	rc.Control(func(fd uintptr) {
+		flags, _, _ = syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_GETFL, 0)
+	})
+	ast.NotZero(flags&syscall.O_NONBLOCK, "the pipe is put into blocking mode")
+}
+
+type cyclicWriter struct {
+	bytes.Buffer
+	w io.Writer
+}
+
+func (w *cyclicWriter) Unwrap() io.Writer {
+	return w.w
+}
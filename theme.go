@@ -0,0 +1,196 @@
+package log
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	colorModeDefault = iota
+	colorModeANSI
+	colorMode256
+	colorModeRGB
+)
+
+// Color is a terminal color of Style, the zero value is the default color of
+// the terminal
+type Color struct {
+	mode    uint8
+	r, g, b uint8
+}
+
+// The 8 basic colors, use ANSIColor(8+n) for their bright variants
+var (
+	Black   = ANSIColor(0)
+	Red     = ANSIColor(1)
+	Green   = ANSIColor(2)
+	Yellow  = ANSIColor(3)
+	Blue    = ANSIColor(4)
+	Magenta = ANSIColor(5)
+	Cyan    = ANSIColor(6)
+	White   = ANSIColor(7)
+)
+
+// ANSIColor returns one of the 16 standard colors, 0-7 are the basic colors
+// and 8-15 the bright ones
+func ANSIColor(n uint8) Color {
+	return Color{mode: colorModeANSI, r: n % 16}
+}
+
+// Color256 returns a color of the 256-color palette
+func Color256(n uint8) Color {
+	return Color{mode: colorMode256, r: n}
+}
+
+// RGB returns a 24-bit true color
+func RGB(r, g, b uint8) Color {
+	return Color{mode: colorModeRGB, r: r, g: g, b: b}
+}
+
+// appendParams appends the SGR parameters of c, base is 30 for foreground
+// and 40 for background
+func (c Color) appendParams(params []string, base int) []string {
+	switch c.mode {
+	case colorModeANSI:
+		if c.r < 8 {
+			return append(params, strconv.Itoa(base+int(c.r)))
+		}
+		return append(params, strconv.Itoa(base+60+int(c.r-8)))
+	case colorMode256:
+		return append(params, strconv.Itoa(base+8), "5", strconv.Itoa(int(c.r)))
+	case colorModeRGB:
+		return append(params, strconv.Itoa(base+8), "2",
+			strconv.Itoa(int(c.r)), strconv.Itoa(int(c.g)), strconv.Itoa(int(c.b)))
+	}
+	return params
+}
+
+// Style describes how a placeholder is painted, the zero value leaves the text
+// unpainted
+type Style struct {
+	Bold      bool
+	Dim       bool
+	Italic    bool
+	Underline bool
+	Fg        Color
+	Bg        Color
+}
+
+// sequence returns the escape sequence which turns on s
+func (s Style) sequence() string {
+	var params []string
+	if s.Bold {
+		params = append(params, "1")
+	}
+	if s.Dim {
+		params = append(params, "2")
+	}
+	if s.Italic {
+		params = append(params, "3")
+	}
+	if s.Underline {
+		params = append(params, "4")
+	}
+	params = s.Fg.appendParams(params, 30)
+	params = s.Bg.appendParams(params, 40)
+	if len(params) == 0 {
+		return ""
+	}
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+const styleRST = "\x1b[0m"
+
+// Theme describes the colors of a Formatter
+//
+// Placeholders are keyed by their names e.g. "level", "datetime", all
+// {{ field "k" }} share the key "field" and the message {{}} is keyed
+// "message". A placeholder with a style in Placeholders is always painted
+// with it, others are painted with the style of the Record level in Levels.
+type Theme struct {
+	// Levels are the styles of each level
+	Levels map[LevelType]Style
+	// Placeholders are the styles of specific placeholders, regardless of level
+	Placeholders map[string]Style
+	// MessageOnly paints only the message with the level style instead of
+	// every placeholder but the message
+	MessageOnly bool
+}
+
+// palette is a Theme with the escape sequences computed
+type palette struct {
+	levels      map[LevelType]string
+	names       map[string]string
+	messageOnly bool
+}
+
+func newPalette(t *Theme) *palette {
+	p := &palette{
+		levels:      make(map[LevelType]string, len(t.Levels)),
+		names:       make(map[string]string, len(t.Placeholders)),
+		messageOnly: t.MessageOnly,
+	}
+	for lv, s := range t.Levels {
+		p.levels[lv] = s.sequence()
+	}
+	for name, s := range t.Placeholders {
+		p.names[name] = s.sequence()
+	}
+	return p
+}
+
+// SetTheme sets the colors used when the Formatter is colored, nil restores
+// the builtin colors which paint every placeholder but the message with the
+// color of level
+func (f *Formatter) SetTheme(t *Theme) {
+	if t == nil {
+		f.palette = nil
+		return
+	}
+	f.palette = newPalette(t)
+}
+
+// style returns the escape sequences which turn on and reset the style of
+// placeholder name for level lv, both empty if it is not painted
+func (f *Formatter) style(name string, lv LevelType) (string, string) {
+	if !f.colored {
+		return "", ""
+	}
+	p := f.palette
+	if p == nil {
+		if name == "message" {
+			return "", ""
+		}
+		return string(levelColor[lv]), colorRST
+	}
+	seq, ok := p.names[name]
+	if !ok && (name == "message") == p.messageOnly {
+		seq = p.levels[lv]
+	}
+	if seq == "" {
+		return "", ""
+	}
+	return seq, styleRST
+}
+
+// ColorEnabled reports whether colored output should be written to w
+//
+// A non-empty NO_COLOR disables colors, otherwise a FORCE_COLOR other than
+// "0" or "false" enables them. TERM=dumb disables colors, otherwise they are
+// enabled only if w is a terminal, see IsTerminal.
+func ColorEnabled(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	switch os.Getenv("FORCE_COLOR") {
+	case "", "0", "false":
+	default:
+		return true
+	}
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return IsTerminal(w)
+}
@@ -0,0 +1,159 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"text/template/parse"
+)
+
+// placeholderNames returns the sorted names of placeholders
+func placeholderNames() []string {
+	names := []string{"field"}
+	for name := range placeholders {
+		names = append(names, name)
+	}
+	for name := range timePlaceholders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// recordMethods are the names of methods of Record, which are the only fields
+// accessible from templates e.g. {{ .Name }}
+var recordMethods = func() []string {
+	t := reflect.TypeOf(&Record{})
+	names := make([]string, t.NumMethod())
+	for i := range names {
+		names[i] = t.Method(i).Name
+	}
+	return names
+}()
+
+var rUndefinedFunc = regexp.MustCompile(`function "([^"]+)" not defined`)
+
+// parseError rewrites the error of parsing a template about an unknown
+// function into an error about the unknown placeholder
+func parseError(err error) error {
+	m := rUndefinedFunc.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	return errors.New("log: unknown placeholder {{ " + m[1] + " }}" +
+		didYouMean(m[1], placeholderNames(), "{{ ", " }}"))
+}
+
+// validate checks the fields of Record accessed by the template, which are
+// only reported while executing by text/template
+func validate(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := validate(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return validate(n.Pipe)
+	case *parse.IfNode:
+		return validateBranch(&n.BranchNode, true)
+	case *parse.RangeNode:
+		// dot is changed inside range and with
+		return validateBranch(&n.BranchNode, false)
+	case *parse.WithNode:
+		return validateBranch(&n.BranchNode, false)
+	case *parse.TemplateNode:
+		return validate(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if err := validate(arg); err != nil {
+					return err
+				}
+			}
+		}
+	case *parse.ChainNode:
+		return validate(n.Node)
+	case *parse.FieldNode:
+		name := n.Ident[0]
+		for _, method := range recordMethods {
+			if method == name {
+				return nil
+			}
+		}
+		return errors.New("log: unknown field ." + name + " of Record" +
+			didYouMean(name, recordMethods, ".", ""))
+	}
+	return nil
+}
+
+func validateBranch(n *parse.BranchNode, sameDot bool) error {
+	if err := validate(n.Pipe); err != nil {
+		return err
+	}
+	if sameDot {
+		if err := validate(n.List); err != nil {
+			return err
+		}
+	}
+	return validate(n.ElseList)
+}
+
+// didYouMean returns a suggestion of the closest candidate to name, or ""
+// if none is close enough
+func didYouMean(name string, candidates []string, prefix, suffix string) string {
+	best, min := "", 3
+	for _, c := range candidates {
+		if d := editDistance(name, c); d < min && d < len(c) {
+			best, min = c, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %s%s%s?", prefix, best, suffix)
+}
+
+// editDistance returns the Levenshtein distance between a and b, ignoring
+// the case of ASCII letters
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if lower(a[i-1]) == lower(b[j-1]) {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func lower(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
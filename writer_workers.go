@@ -1,56 +1,382 @@
 package log
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	maxRecordChanSize = 100000
 )
 
+// ErrFlushTimeout is returned when async records are not written in time
+var ErrFlushTimeout = errors.New("log: flush timeout")
+
+// DropReportInterval is how often a "dropped N records" record is logged
+// through the handler of a writer which dropped records
+var DropReportInterval = 10 * time.Second
+
+// OverflowPolicy decides what to do with a record when the async queue of a
+// writer is full
+type OverflowPolicy int
+
+const (
+	// DropNewest throws the record away
+	DropNewest OverflowPolicy = iota
+	// DropOldest throws the oldest queued record away to make room
+	DropOldest
+	// Block waits until there is room in the queue
+	Block
+	// BlockTimeout waits for at most QueueOptions.Timeout before throwing
+	// the record away
+	BlockTimeout
+)
+
+// QueueOptions configures the async queue of a writer
+type QueueOptions struct {
+	// Size of the queue, only used when the queue is created
+	Size    int
+	Policy  OverflowPolicy
+	Timeout time.Duration
+}
+
+var defaultQueueOptions = QueueOptions{
+	Size:   maxRecordChanSize,
+	Policy: DropNewest,
+}
+
+// QueueStats counts records passed through async queues
+type QueueStats struct {
+	Enqueued uint64
+	Dropped  uint64
+	Written  uint64
+}
+
+func (s QueueStats) add(o QueueStats) QueueStats {
+	return QueueStats{
+		Enqueued: s.Enqueued + o.Enqueued,
+		Dropped:  s.Dropped + o.Dropped,
+		Written:  s.Written + o.Written,
+	}
+}
+
+type writerJob struct {
+	h    Handler
+	r    *Record
+	done chan struct{}
+}
+
 type writerWorker struct {
-	ch chan func()
+	// accessed atomically, keep them first for alignment
+	enqueued      uint64
+	dropped       uint64
+	written       uint64
+	droppedReport uint64
+
+	ch       chan writerJob
+	mu       sync.RWMutex
+	opts     QueueOptions
+	explicit bool
+	// tick triggers drop reports, a ticker of DropReportInterval is used if
+	// nil when the worker starts
+	tick <-chan time.Time
+
+	// stop is closed when the worker is removed, stopped is closed when the
+	// worker exits after draining its queue
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func newWriterWorker(opts QueueOptions) *writerWorker {
+	if opts.Size <= 0 {
+		opts.Size = maxRecordChanSize
+	}
+	return &writerWorker{
+		ch:      make(chan writerJob, opts.Size),
+		opts:    opts,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
 }
 
 func (w *writerWorker) Start() {
 	go func() {
-		for ff := range w.ch {
-			ff()
+		defer close(w.stopped)
+		tick := w.tick
+		if tick == nil {
+			ticker := time.NewTicker(DropReportInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		var last writerJob
+		for {
+			select {
+			case job := <-w.ch:
+				w.do(job)
+				if job.done == nil {
+					last = job
+				}
+			case <-tick:
+				if last.h != nil {
+					w.reportDropped(last)
+				}
+			case <-w.stop:
+				for {
+					select {
+					case job := <-w.ch:
+						w.do(job)
+					default:
+						return
+					}
+				}
+			}
 		}
 	}()
 }
 
+func (w *writerWorker) do(job writerJob) {
+	if job.done != nil {
+		close(job.done)
+		return
+	}
+	job.h.Log(job.r)
+	atomic.AddUint64(&w.written, 1)
+}
+
+// Stop makes the worker exit once its queue is drained
+func (w *writerWorker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// reportDropped logs the number of records dropped since last report through
+// the handler of job
+func (w *writerWorker) reportDropped(job writerJob) {
+	dropped := atomic.LoadUint64(&w.dropped)
+	n := dropped - atomic.SwapUint64(&w.droppedReport, dropped)
+	if n == 0 {
+		return
+	}
+	job.h.Log(&Record{
+		name:  job.r.name,
+		now:   time.Now(),
+		lv:    WARN,
+		msg:   fmt.Sprintf("dropped %d records", n),
+		appID: job.r.appID,
+	})
+}
+
+func (w *writerWorker) options(opts *QueueOptions) QueueOptions {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.explicit || opts == nil {
+		return w.opts
+	}
+	return *opts
+}
+
+func (w *writerWorker) enqueue(job writerJob, opts QueueOptions) {
+	select {
+	case w.ch <- job:
+		atomic.AddUint64(&w.enqueued, 1)
+		return
+	default:
+	}
+
+	switch opts.Policy {
+	case DropOldest:
+		w.dropOldest(job)
+		return
+	case Block:
+		w.ch <- job
+		atomic.AddUint64(&w.enqueued, 1)
+		return
+	case BlockTimeout:
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		select {
+		case w.ch <- job:
+			atomic.AddUint64(&w.enqueued, 1)
+			return
+		case <-timer.C:
+		}
+	}
+	atomic.AddUint64(&w.dropped, 1)
+}
+
+// dropOldest queues job, dropping the oldest records to make room
+//
+// Flush marks are never dropped, those taken out of the queue are queued
+// again after job, which only delays the Flush waiting for them.
+func (w *writerWorker) dropOldest(job writerJob) {
+	pending := []writerJob{job}
+	for len(pending) > 0 {
+		select {
+		case w.ch <- pending[0]:
+			if pending[0].done == nil {
+				atomic.AddUint64(&w.enqueued, 1)
+			}
+			pending = pending[1:]
+			continue
+		default:
+		}
+		// the queue is full, take the oldest job out
+		select {
+		case old := <-w.ch:
+			if old.done != nil {
+				pending = append(pending, old)
+			} else {
+				atomic.AddUint64(&w.dropped, 1)
+			}
+		default:
+		}
+	}
+}
+
+func (w *writerWorker) Stats() QueueStats {
+	return QueueStats{
+		Enqueued: atomic.LoadUint64(&w.enqueued),
+		Dropped:  atomic.LoadUint64(&w.dropped),
+		Written:  atomic.LoadUint64(&w.written),
+	}
+}
+
 type writerSupervisor struct {
 	m  map[io.Writer]*writerWorker
 	mu sync.RWMutex
 }
 
-func (ws *writerSupervisor) Do(w io.Writer, f func()) {
+// worker returns the worker of w, which is created with opts if not exists
+func (ws *writerSupervisor) worker(w io.Writer, opts *QueueOptions) *writerWorker {
 	ws.mu.RLock()
 	worker, ok := ws.m[w]
 	ws.mu.RUnlock()
+	if ok {
+		return worker
+	}
+
+	if opts == nil {
+		opts = &defaultQueueOptions
+	}
+	worker = newWriterWorker(*opts)
+
+	ws.mu.Lock()
+	if currentWorker, ok := ws.m[w]; ok {
+		worker = currentWorker
+	} else {
+		ws.m[w] = worker
+		worker.Start()
+	}
+	ws.mu.Unlock()
+	return worker
+}
 
-	if !ok {
-		worker = &writerWorker{
-			ch: make(chan func(), maxRecordChanSize),
+// Do queues the Record to be logged by h, opts are the options of the logger
+// which are overridden by options set by Configure
+//
+// The record is queued with the lock held, so the worker can't be removed
+// and stopped before the record is queued.
+func (ws *writerSupervisor) Do(h Handler, r *Record, opts *QueueOptions) {
+	w := h.Writer()
+	for {
+		ws.mu.RLock()
+		worker, ok := ws.m[w]
+		if ok {
+			worker.enqueue(writerJob{h: h, r: r}, worker.options(opts))
+			ws.mu.RUnlock()
+			return
 		}
+		ws.mu.RUnlock()
+		ws.worker(w, opts)
+	}
+}
 
-		ws.mu.Lock()
-		if currentWorker, ok := ws.m[w]; ok {
-			worker = currentWorker
-		} else {
-			ws.m[w] = worker
-			worker.Start()
+// Remove removes the worker of w, which exits after writing records already
+// queued, it waits for Do calls queueing records to the worker
+func (ws *writerSupervisor) Remove(w io.Writer) {
+	ws.mu.Lock()
+	worker, ok := ws.m[w]
+	delete(ws.m, w)
+	ws.mu.Unlock()
+	if ok {
+		worker.Stop()
+	}
+}
+
+// Configure sets the options of the queue of w, the size of an existing
+// queue is not changed
+func (ws *writerSupervisor) Configure(w io.Writer, opts QueueOptions) {
+	worker := ws.worker(w, &opts)
+	worker.mu.Lock()
+	worker.opts = opts
+	worker.explicit = true
+	worker.mu.Unlock()
+}
+
+// Stats returns the stats of given writers, nil writers for all writers
+func (ws *writerSupervisor) Stats(writers []io.Writer) QueueStats {
+	var stats QueueStats
+	for _, worker := range ws.workers(writers) {
+		stats = stats.add(worker.Stats())
+	}
+	return stats
+}
+
+func (ws *writerSupervisor) workers(writers []io.Writer) []*writerWorker {
+	var workers []*writerWorker
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	if writers == nil {
+		for _, worker := range ws.m {
+			workers = append(workers, worker)
 		}
-		ws.mu.Unlock()
+		return workers
 	}
+	for _, w := range writers {
+		if worker, ok := ws.m[w]; ok {
+			workers = append(workers, worker)
+		}
+	}
+	return workers
+}
 
-	select {
-	case worker.ch <- f:
-	default:
-		//throw message if full
+// Flush waits until all records queued for given writers before the call
+// are written, nil writers for all writers
+func (ws *writerSupervisor) Flush(writers []io.Writer, timeout time.Duration) error {
+	workers := ws.workers(writers)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	type mark struct {
+		worker *writerWorker
+		done   chan struct{}
+	}
+	marks := make([]mark, 0, len(workers))
+	for _, worker := range workers {
+		done := make(chan struct{})
+		select {
+		case worker.ch <- writerJob{done: done}:
+			marks = append(marks, mark{worker, done})
+		case <-worker.stopped:
+		case <-timer.C:
+			return ErrFlushTimeout
+		}
+	}
+	for _, m := range marks {
+		select {
+		case <-m.done:
+		case <-m.worker.stopped:
+		case <-timer.C:
+			return ErrFlushTimeout
+		}
 	}
+	return nil
 }
 
 func newWriterSupervisor() *writerSupervisor {